@@ -0,0 +1,28 @@
+package claudine_bot
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authorized checks the request's bearer token against token. An empty token
+// never authorizes anything.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// requireAdmin only lets requests carrying the admin token through to h.
+func requireAdmin(adminToken string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, adminToken) {
+			encodeError(r.Context(), ErrUnauthorized, w)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
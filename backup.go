@@ -0,0 +1,346 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	bolt "github.com/etcd-io/bbolt"
+	"github.com/go-kit/kit/log"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix = "claudine-"
+	backupSuffix = ".db"
+)
+
+var (
+	ErrSnapshotUnsupported = errors.New("store does not support snapshots")
+	ErrInvalidBackup       = errors.New("invalid backup")
+)
+
+// Snapshotter is implemented by stores that can write a consistent copy of
+// themselves while still in use.
+type Snapshotter interface {
+	Snapshot(w io.Writer) (int64, error)
+}
+
+// Snapshot writes a consistent copy of the store to w.
+func Snapshot(store Store, w io.Writer) (int64, error) {
+	s, ok := store.(Snapshotter)
+	if !ok {
+		return 0, ErrSnapshotUnsupported
+	}
+	return s.Snapshot(w)
+}
+
+func (s *boltStore) Snapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Backuper takes scheduled snapshots of a store, keeping the newest few.
+type Backuper struct {
+	store    Store
+	dir      string
+	keep     int
+	interval time.Duration
+	logger   log.Logger
+}
+
+func NewBackuper(store Store, dir string, keep int, interval time.Duration, logger log.Logger) *Backuper {
+	return &Backuper{
+		store:    store,
+		dir:      dir,
+		keep:     keep,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run takes a backup every interval until ctx is cancelled.
+func (b *Backuper) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := b.Backup()
+			if err != nil {
+				b.logger.Log("msg", "backup failed", "err", err)
+				continue
+			}
+			b.logger.Log("msg", "backup written", "path", path)
+		}
+	}
+}
+
+// Backup writes a snapshot into the backup directory and removes the oldest
+// backups beyond the number to keep.
+func (b *Backuper) Backup() (string, error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so a failed backup never looks complete
+	tmp, err := ioutil.TempFile(b.dir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := Snapshot(b.store, tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	name := backupPrefix + time.Now().UTC().Format("20060102T150405Z") + backupSuffix
+	path := filepath.Join(b.dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return path, b.rotate()
+}
+
+// Backups returns the paths of every backup in the directory, oldest first.
+func (b *Backuper) Backups() ([]string, error) {
+	files, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), backupPrefix) && strings.HasSuffix(f.Name(), backupSuffix) {
+			backups = append(backups, filepath.Join(b.dir, f.Name()))
+		}
+	}
+
+	// Timestamps in the names sort chronologically
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (b *Backuper) rotate() error {
+	backups, err := b.Backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > b.keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// MakeBackupHandler streams a snapshot of the store. Requests must carry the
+// admin token as a bearer token; the handler is disabled without one. Stores
+// that can't snapshot answer 501.
+func MakeBackupHandler(store Store, adminToken string, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, adminToken) {
+			encodeError(r.Context(), ErrUnauthorized, w)
+			return
+		}
+		snapshotter, ok := store.(Snapshotter)
+		if !ok {
+			encodeError(r.Context(), ErrSnapshotUnsupported, w)
+			return
+		}
+
+		name := backupPrefix + time.Now().UTC().Format("20060102T150405Z") + backupSuffix
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if _, err := snapshotter.Snapshot(w); err != nil {
+			// Headers are gone by now, the best we can do is log it
+			logger.Log("msg", "backup failed", "err", err)
+		}
+	})
+}
+
+// checkBoltSize checks that the file at path holds every page its newest valid
+// bolt meta page says it has. Bolt reads pages straight from the file mapped in
+// memory, so opening a truncated database crashes rather than failing.
+func checkBoltSize(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Each meta page is a 16 byte page header followed by magic, version, page
+	// size, flags, root bucket, freelist, page count, txid and checksum. The
+	// page size is read from the first one.
+	const headerSize, metaSize = 16, 64
+	buf := make([]byte, headerSize+metaSize)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return errors.New("file too small")
+	}
+	pageSize := int64(binary.LittleEndian.Uint32(buf[headerSize+8:]))
+	if pageSize < headerSize+metaSize {
+		return errors.New("invalid page size")
+	}
+
+	var pages, txid uint64
+	found := false
+	for i := int64(0); i < 2; i++ {
+		if _, err := f.ReadAt(buf, i*pageSize); err != nil {
+			return errors.New("file too small")
+		}
+		meta := buf[headerSize:]
+		if binary.LittleEndian.Uint32(meta) != 0xED0CDAED {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write(meta[:56])
+		if h.Sum64() != binary.LittleEndian.Uint64(meta[56:]) {
+			continue
+		}
+		if t := binary.LittleEndian.Uint64(meta[48:]); !found || t > txid {
+			pages, txid, found = binary.LittleEndian.Uint64(meta[40:]), t, true
+		}
+	}
+	if !found {
+		return errors.New("no valid meta page")
+	}
+	if uint64(info.Size()) < pages*uint64(pageSize) {
+		return fmt.Errorf("file is %d bytes but holds %d pages of %d bytes", info.Size(), pages, pageSize)
+	}
+	return nil
+}
+
+// ValidateBackup checks that the file at path is an intact bolt database with
+// a schema this version understands.
+func ValidateBackup(path string) (err error) {
+	// Bolt panics on some corrupt pages rather than returning an error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v: %v", ErrInvalidBackup, r)
+		}
+	}()
+
+	if err := checkBoltSize(path); err != nil {
+		return fmt.Errorf("%v: %v", ErrInvalidBackup, err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrInvalidBackup, err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		// Read every error so the checker finishes before the database closes
+		var first error
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrInvalidBackup, err)
+	}
+
+	var version int
+	err = NewBoltStore(db).View(func(tx Tx) error {
+		var err error
+		version, err = SchemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrInvalidBackup, err)
+	}
+	if version > Migrations[len(Migrations)-1].Version {
+		return ErrSchemaTooNew
+	}
+	return nil
+}
+
+// RestoreBackup validates the backup and swaps it in for the database at path.
+// The current database is kept alongside with a .bak suffix. The bot must not
+// be running.
+func RestoreBackup(backup string, path string) error {
+	if err := ValidateBackup(backup); err != nil {
+		return err
+	}
+
+	// Make sure nothing else has the database open
+	if _, err := os.Stat(path); err == nil {
+		db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return fmt.Errorf("database is in use: %v", err)
+		}
+		db.Close()
+	}
+
+	// Copy next to the database first so the final swap is a rename
+	src, err := os.Open(backup)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".bak"); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
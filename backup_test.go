@@ -0,0 +1,103 @@
+package claudine_bot_test
+
+import (
+	bolt "github.com/etcd-io/bbolt"
+	"github.com/go-kit/kit/log"
+	"github.com/rcole5/claudine-bot"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBackup makes a migrated bolt database at path, with the schema version
+// overridden when version isn't empty.
+func writeBackup(t *testing.T, path string, version string) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("open bolt: %v", err)
+	}
+	defer db.Close()
+
+	store := claudine_bot.NewBoltStore(db)
+	if err := claudine_bot.Migrate(store, log.NewNopLogger()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if version == "" {
+		return
+	}
+	err = store.Update(func(tx claudine_bot.Tx) error {
+		return tx.Bucket([]byte("meta")).Put([]byte("schema_version"), []byte(version))
+	})
+	if err != nil {
+		t.Fatalf("set schema version: %v", err)
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, path string)
+		err   error
+	}{
+		{"Valid", func(t *testing.T, path string) {
+			writeBackup(t, path, "")
+		}, nil},
+		{"Garbage", func(t *testing.T, path string) {
+			if err := ioutil.WriteFile(path, []byte(strings.Repeat("not a database ", 1000)), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, claudine_bot.ErrInvalidBackup},
+		{"Truncated", func(t *testing.T, path string) {
+			writeBackup(t, path, "")
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(path, info.Size()/2); err != nil {
+				t.Fatal(err)
+			}
+		}, claudine_bot.ErrInvalidBackup},
+		{"Corrupted", func(t *testing.T, path string) {
+			writeBackup(t, path, "")
+			raw, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Keep the meta pages and scramble everything after them
+			for i := 2 * os.Getpagesize(); i < len(raw); i++ {
+				raw[i] = 0xff
+			}
+			if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, claudine_bot.ErrInvalidBackup},
+		{"Empty", func(t *testing.T, path string) {
+			if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, claudine_bot.ErrInvalidBackup},
+		{"SchemaTooNew", func(t *testing.T, path string) {
+			writeBackup(t, path, "999")
+		}, claudine_bot.ErrSchemaTooNew},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "backup.db")
+			test.write(t, path)
+
+			err := claudine_bot.ValidateBackup(path)
+			if test.err == nil {
+				if err != nil {
+					t.Fatalf("ValidateBackup() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.err.Error()) {
+				t.Fatalf("ValidateBackup() = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
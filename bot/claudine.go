@@ -4,30 +4,42 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	bolt "github.com/etcd-io/bbolt"
 	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/nicklaw5/helix"
 	"github.com/pkg/errors"
 	"github.com/rcole5/claudine-bot"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
 
 var (
-	Client      *twitch.Client
 	HelixClient *helix.Client
 	service     claudine_bot.Service
+	logger      log.Logger
+	chatLogger  log.Logger
+
+	joinedMtx sync.Mutex
+	// joined has the connection that joined each channel.
+	joined = make(map[string]*connection)
 )
 
-func New(s claudine_bot.Service, user string, token string, db *bolt.DB) {
+// How long to wait before reconnecting to IRC.
+const reconnectDelay = 5 * time.Second
+
+// New connects the bot to twitch as the default account, and as every bot
+// account in the service, and blocks until ctx is cancelled, at which point it
+// stops its tickers, parts every channel and disconnects.
+func New(ctx context.Context, s claudine_bot.Service, user string, token string, l log.Logger) {
 	// Init the service
 	service = s
-
-	// Connect to twitch
-	Client = twitch.NewClient(user, token)
+	logger = l
+	chatLogger = newChatLogger(l, os.Getenv("CHAT_LOG_LEVEL"))
 
 	var err error
 	HelixClient, err = helix.NewClient(&helix.Options{
@@ -37,176 +49,465 @@ func New(s claudine_bot.Service, user string, token string, db *bolt.DB) {
 		panic(err)
 	}
 
-	// Listen for new messages
-	Client.OnNewMessage(handleMessage)
+	// Connect to twitch, reconnecting whenever a connection drops
+	defaultAccount = strings.ToLower(user)
+	startConnection(ctx, user, token)
+	syncAccounts(ctx)
 
-	// Every minute check if we need to join or leave any channel
+	var wg sync.WaitGroup
+
+	// Every minute check the bot accounts, if we need to join or leave any
+	// channel, and forget expired filter state
 	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	wg.Add(1)
 	go func() {
-		currentChannels := make(map[string]struct{})
-		for range ticker.C {
-			channels, err := s.ListChannel(context.Background())
-			if err != nil {
-				panic(err)
-			}
-			for _, channel := range channels {
-				_, ok := currentChannels[string(channel)]
-				if !ok {
-					fmt.Println("Joined:", strings.TrimSpace(string(channel)))
-					Client.Join(string(channel))
-					currentChannels[string(channel)] = struct{}{}
-				}
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				syncAccounts(ctx)
+				joinChannels(ctx)
+				pruneFilters(time.Now())
 			}
 		}
 	}()
 
 	// Check repeat commands
 	repeatTicker := time.NewTicker(1 * time.Minute)
+	defer repeatTicker.Stop()
+	wg.Add(1)
 	go func() {
-		for range repeatTicker.C {
-			channels, err := s.ListChannel(context.Background())
-			if err != nil {
-				panic(err)
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-repeatTicker.C:
+				postRepeatCommands(ctx)
 			}
-			for _, channel := range channels {
-				if !isChannelLive(string(channel)) {
+		}
+	}()
+
+	// Award points to viewers of live channels
+	pointsTicker := time.NewTicker(1 * time.Minute)
+	defer pointsTicker.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-pointsTicker.C:
+				awardPoints(ctx)
+			}
+		}
+	}()
+
+	// Close polls when they end
+	pollTicker := time.NewTicker(5 * time.Second)
+	defer pollTicker.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-pollTicker.C:
+				closeExpiredPolls(ctx)
+			}
+		}
+	}()
+
+	// Look for new followers
+	followTicker := time.NewTicker(1 * time.Minute)
+	defer followTicker.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-followTicker.C:
+				checkFollows(ctx)
+			}
+		}
+	}()
+
+	// Keep the stream status of every channel fresh
+	streamTicker := time.NewTicker(streamPollInterval)
+	defer streamTicker.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		pollStreams(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-streamTicker.C:
+				pollStreams(ctx)
+			}
+		}
+	}()
+
+	// Connections part their channels and disconnect once ctx is done
+	<-ctx.Done()
+	level.Info(logger).Log("msg", "shutting down")
+	wg.Wait()
+	connsWG.Wait()
+}
+
+// joinChannels joins any enabled channel the bot isn't in yet, and moves
+// channels that chose another account over to it.
+func joinChannels(ctx context.Context) {
+	channels, err := service.ListChannel(ctx)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list channels", "err", err)
+		return
+	}
+
+	for _, channel := range channels {
+		c := accountFor(string(channel))
+		if c == nil {
+			continue
+		}
+
+		joinedMtx.Lock()
+		current, ok := joined[string(channel)]
+		if ok && current == c {
+			joinedMtx.Unlock()
+			continue
+		}
+		if ok {
+			current.client.Depart(string(channel))
+		}
+		c.client.Join(string(channel))
+		joined[string(channel)] = c
+		joinedMtx.Unlock()
+
+		level.Info(logger).Log("msg", "joined", "channel", strings.TrimSpace(string(channel)), "account", c.account)
+		if !ok {
+			trackOpenPoll(ctx, string(channel))
+		}
+	}
+}
+
+// postRepeatCommands posts any repeat commands that are due in live channels.
+func postRepeatCommands(ctx context.Context) {
+	channels, err := service.ListChannel(ctx)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list channels", "err", err)
+		return
+	}
+	for _, channel := range channels {
+		if !isChannelLive(string(channel)) {
+			continue
+		}
+
+		repeatCommands, err := service.ListRepeatCommand(ctx, string(channel))
+		if err != nil {
+			continue
+		}
+
+		for _, repeatCommand := range repeatCommands {
+			if time.Now().Minute()%repeatCommand.Duration == 0 {
+				command, err := service.GetCommand(ctx, string(channel), repeatCommand.Trigger)
+				if err != nil {
 					continue
 				}
 
-				repeatCommands, err := s.ListRepeatCommand(context.Background(), string(channel))
+				response, err := GetCommandString(string(channel), command, twitch.User{})
 				if err != nil {
+					level.Warn(logger).Log("msg", "failed to render repeat command", "channel", channel, "trigger", command.Trigger, "err", err)
 					continue
 				}
-				
-				for _, repeatCommand := range repeatCommands {
-					if time.Now().Minute() % repeatCommand.Duration == 0 {
-						command, err := s.GetCommand(context.Background(), string(channel), repeatCommand.Trigger)
-						if err != nil {
-							continue
-						}
-
-						response, err := GetCommandString(command, twitch.User{})
-						Client.Say(string(channel), response)
-					}
-				}
+				say(string(channel), response, priorityLow)
+				repeatPosts.With("channel", string(channel)).Add(1)
 			}
 		}
-	}()
-
-	// Start the bot
-	if err := Client.Connect(); err != nil {
-		panic(err)
 	}
 }
 
 func handleMessage(channel string, user twitch.User, message twitch.Message) {
-	fmt.Printf("%s@%s: %s\n", user.DisplayName, channel, message.Text)
+	chatLogger.Log("channel", channel, "user", user.DisplayName, "msg_id", message.Tags["id"], "text", message.Text)
+	messagesSeen.With("channel", channel).Add(1)
+	addViewer(channel, user.Username)
+	settings := getSettings(channel)
+
+	// Tag service calls with the chat message ID so they can be correlated in the logs
+	ctx := claudine_bot.WithRequestID(context.Background(), message.Tags["id"])
+
+	if message.Tags["bits"] != "" {
+		handleCheer(channel, user, message)
+	}
+
+	if moderate(channel, user, message, settings) {
+		return
+	}
+
+	if settings.BuiltinEnabled("raffle") && enterRaffle(ctx, channel, user, message.Text) {
+		return
+	}
+
 	msg := strings.Split(message.Text, " ")
-	if msg[0][0] != '!' {
+	if !strings.HasPrefix(msg[0], settings.Prefix) {
 		return
 	}
+	trigger := strings.TrimPrefix(msg[0], settings.Prefix)
 
-	if msg[0] == "!uptime" {
-		users, err := HelixClient.GetStreams(&helix.StreamsParams{
-			UserLogins: []string{channel},
-		})
+	if trigger == "uptime" && settings.BuiltinEnabled("uptime") {
+		commandsExecuted.With("channel", channel, "command", "uptime").Add(1)
+		stream, live, err := streamInfo(channel)
 		if err != nil {
-			panic(err)
+			level.Error(logger).Log("msg", "failed to get stream", "channel", channel, "err", err)
+			return
 		}
 
-		if len(users.Data.Streams) == 0 {
-			Client.Say(channel, "User is not live")
+		if !live {
+			respond(channel, user, settings, "User is not live")
 			return
 		}
 
-		duration := fmtDuration(time.Since(users.Data.Streams[0].StartedAt))
+		duration := fmtDuration(time.Since(stream.StartedAt))
 
-		Client.Say(channel, channel + " has been live for " + duration)
+		respond(channel, user, settings, channel+" has been live for "+duration)
+		return
+	}
+
+	if trigger == "title" && settings.BuiltinEnabled("title") {
+		commandsExecuted.With("channel", channel, "command", "title").Add(1)
+		handleTitle(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "game" && settings.BuiltinEnabled("game") {
+		commandsExecuted.With("channel", channel, "command", "game").Add(1)
+		handleGame(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "viewers" && settings.BuiltinEnabled("viewers") {
+		commandsExecuted.With("channel", channel, "command", "viewers").Add(1)
+		handleViewers(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "followage" && settings.BuiltinEnabled("followage") {
+		commandsExecuted.With("channel", channel, "command", "followage").Add(1)
+		handleFollowage(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "accountage" && settings.BuiltinEnabled("accountage") {
+		commandsExecuted.With("channel", channel, "command", "accountage").Add(1)
+		handleAccountage(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "settitle" && settings.BuiltinEnabled("title") {
+		commandsExecuted.With("channel", channel, "command", "settitle").Add(1)
+		handleSetTitle(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "setgame" && settings.BuiltinEnabled("game") {
+		commandsExecuted.With("channel", channel, "command", "setgame").Add(1)
+		handleSetGame(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "so" && settings.BuiltinEnabled("so") {
+		commandsExecuted.With("channel", channel, "command", "so").Add(1)
+		handleShoutout(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "counter" && settings.BuiltinEnabled("counter") {
+		commandsExecuted.With("channel", channel, "command", "counter").Add(1)
+		handleCounter(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "quote" && settings.BuiltinEnabled("quote") {
+		commandsExecuted.With("channel", channel, "command", "quote").Add(1)
+		handleQuote(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "addquote" && settings.BuiltinEnabled("quote") {
+		commandsExecuted.With("channel", channel, "command", "addquote").Add(1)
+		handleAddQuote(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "delquote" && settings.BuiltinEnabled("quote") {
+		commandsExecuted.With("channel", channel, "command", "delquote").Add(1)
+		handleDelQuote(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "points" && settings.BuiltinEnabled("points") {
+		commandsExecuted.With("channel", channel, "command", "points").Add(1)
+		handlePoints(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "give" && settings.BuiltinEnabled("points") {
+		commandsExecuted.With("channel", channel, "command", "give").Add(1)
+		handleGive(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "addpoints" && settings.BuiltinEnabled("points") {
+		commandsExecuted.With("channel", channel, "command", "addpoints").Add(1)
+		handleAddPoints(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "raffle" && settings.BuiltinEnabled("raffle") {
+		commandsExecuted.With("channel", channel, "command", "raffle").Add(1)
+		handleRaffle(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "poll" && settings.BuiltinEnabled("poll") {
+		commandsExecuted.With("channel", channel, "command", "poll").Add(1)
+		handlePoll(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "vote" && settings.BuiltinEnabled("poll") {
+		commandsExecuted.With("channel", channel, "command", "vote").Add(1)
+		handleVote(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "sr" && settings.BuiltinEnabled("songrequest") {
+		commandsExecuted.With("channel", channel, "command", "sr").Add(1)
+		handleSongRequest(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "queue" && settings.BuiltinEnabled("songrequest") {
+		commandsExecuted.With("channel", channel, "command", "queue").Add(1)
+		handleQueue(ctx, channel, user, settings)
+		return
+	}
+	if trigger == "skip" && settings.BuiltinEnabled("songrequest") {
+		commandsExecuted.With("channel", channel, "command", "skip").Add(1)
+		handleSkip(ctx, channel, user, settings)
+		return
+	}
+	if trigger == "wrongsong" && settings.BuiltinEnabled("songrequest") {
+		commandsExecuted.With("channel", channel, "command", "wrongsong").Add(1)
+		handleWrongSong(ctx, channel, user, settings)
+		return
+	}
+
+	if trigger == "permit" && settings.BuiltinEnabled("permit") {
+		commandsExecuted.With("channel", channel, "command", "permit").Add(1)
+		handlePermit(ctx, channel, user, settings, msg[1:])
+		return
+	}
+
+	if trigger == "warn" && settings.BuiltinEnabled("warn") {
+		commandsExecuted.With("channel", channel, "command", "warn").Add(1)
+		handleWarn(ctx, channel, user, settings, msg[1:])
+		return
+	}
+	if trigger == "warnings" && settings.BuiltinEnabled("warn") {
+		commandsExecuted.With("channel", channel, "command", "warnings").Add(1)
+		handleWarnings(ctx, channel, user, settings, msg[1:])
 		return
 	}
 
 	if isMod(user) {
-		if msg[0] == "!add" {
+		if trigger == "add" {
+			commandsExecuted.With("channel", channel, "command", "add").Add(1)
 			if len(msg) < 3 {
-				Client.Say(channel, "Not enough args. Syntax is !add command response.")
+				respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"add command response.")
 				return
 			}
-			_, err := service.NewCommand(context.Background(), channel, claudine_bot.Command{
+			_, err := service.NewCommand(ctx, channel, claudine_bot.Command{
 				Trigger: msg[1],
 				Action:  strings.Join(msg[2:], " "),
 			})
 			if err != nil {
-				Client.Say(channel, "This command already exists.")
+				respond(channel, user, settings, "This command already exists.")
 				return
 			}
-			Client.Say(channel, "Command added. VoHiYo")
+			respond(channel, user, settings, "Command added. VoHiYo")
 			return
-		} else if msg[0] == "!remove" {
+		} else if trigger == "remove" {
+			commandsExecuted.With("channel", channel, "command", "remove").Add(1)
 			if len(msg) < 2 {
-				Client.Say(channel, "Not enough args. Syntax is !remove command.")
+				respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"remove command.")
 				return
 			}
-			err := service.DeleteCommand(context.Background(), channel, msg[1])
+			err := service.DeleteCommand(ctx, channel, msg[1])
 			if err != nil {
-				Client.Say(channel, "This commands doesn't exist, baka.")
+				respond(channel, user, settings, "This commands doesn't exist, baka.")
 				return
 			}
-			Client.Say(channel, "Command deleted.")
+			respond(channel, user, settings, "Command deleted.")
 			return
-		} else if msg[0] == "!repeat" {
+		} else if trigger == "repeat" {
+			commandsExecuted.With("channel", channel, "command", "repeat").Add(1)
 			if len(msg) < 3 {
-				Client.Say(channel, "Not enough args. Syntax is !repeat <command> <minutes>.")
+				respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"repeat <command> <minutes>.")
 				return
 			}
 			intDuration, _ := strconv.Atoi(msg[2])
-			_, err := service.NewRepeatCommand(context.Background(), channel, msg[1], intDuration)
+			_, err := service.NewRepeatCommand(ctx, channel, msg[1], intDuration)
 			if err != nil {
-				Client.Say(channel, "Error creating repeat command")
+				respond(channel, user, settings, "Error creating repeat command")
 				return
 			}
-			Client.Say(channel, "Command repeated.")
+			respond(channel, user, settings, "Command repeated.")
 			return
 		}
 	}
-	command, err := service.GetCommand(context.Background(), channel, msg[0][1:])
-	if err != nil {
-		// Command doesn't exist. Should prob add an error code here in case it's a different error.
+	command, err := service.GetCommand(ctx, channel, trigger)
+	if err != nil && err != claudine_bot.ErrNotFound {
+		level.Error(logger).Log("msg", "failed to get command", "channel", channel, "trigger", trigger, "err", err)
 	}
 
 	if command.Trigger != "" {
-		response, err := GetCommandString(command, user)
+		// Mods aren't subject to cooldowns
+		if !isMod(user) && onCooldown(channel, command.Trigger, user, settings) {
+			return
+		}
+
+		commandsExecuted.With("channel", channel, "command", command.Trigger).Add(1)
+		response, err := GetCommandString(channel, command, user)
 		if err != nil {
-			Client.Say(channel, err.Error())
+			respond(channel, user, settings, err.Error())
 			return
 		}
 
-		Client.Say(channel, response)
+		respond(channel, user, settings, response)
+		notifyCommandExecuted(channel, command, user)
 	}
 }
 
 func isChannelLive(channel string) bool {
-	users, err := HelixClient.GetStreams(&helix.StreamsParams{
-		UserLogins: []string{string(channel)},
-	})
-	if err != nil {
-		return false
-	}
-
-	// User is not live
-	return len(users.Data.Streams) != 0
+	_, live, err := streamInfo(channel)
+	return err == nil && live
 }
 
-func GetCommandString(command claudine_bot.Command, user twitch.User) (string, error) {
+func GetCommandString(channel string, command claudine_bot.Command, user twitch.User) (string, error) {
 	// Parse any variables
-	t, err := template.New("Parse Command").Parse(command.Action)
+	t, err := template.New("Parse Command").Funcs(commandFuncs(channel, user)).Parse(command.Action)
 	if err != nil {
 		return "", errors.New("Failed to parse command")
 	}
 
+	// Times are shown in the channel's timezone
+	location, err := time.LoadLocation(getSettings(channel).Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
 	// Prepare the variables
 	vars := Variables{
-		User:   user.Username,
-		UserID: user.UserID,
+		User:    user.Username,
+		UserID:  user.UserID,
+		Channel: channel,
+		Now:     time.Now().In(location),
 	}
 
 	buf := new(bytes.Buffer)
@@ -215,9 +516,24 @@ func GetCommandString(command claudine_bot.Command, user twitch.User) (string, e
 	return buf.String(), nil
 }
 
+// commandFuncs are the functions available to command templates.
+func commandFuncs(channel string, user twitch.User) template.FuncMap {
+	return template.FuncMap{
+		"counter":    counterFunc(channel),
+		"points":     pointsFunc(channel, user),
+		"title":      titleFunc(channel),
+		"game":       gameFunc(channel),
+		"viewers":    viewersFunc(channel),
+		"followage":  followageFunc(channel, user),
+		"accountage": accountageFunc(user),
+	}
+}
+
 type Variables struct {
-	User   string
-	UserID int64
+	User    string
+	UserID  int64
+	Channel string
+	Now     time.Time
 }
 
 func isMod(user twitch.User) bool {
@@ -231,3 +547,20 @@ func fmtDuration(d time.Duration) string {
 	m := d / time.Minute
 	return fmt.Sprintf("%02d:%02d", h, m)
 }
+
+// newChatLogger returns a logger for chat messages at the named level. Chat
+// logging is disabled with "none" and defaults to debug.
+func newChatLogger(l log.Logger, name string) log.Logger {
+	switch strings.ToLower(name) {
+	case "none":
+		return log.NewNopLogger()
+	case "error":
+		return level.Error(l)
+	case "warn":
+		return level.Warn(l)
+	case "info":
+		return level.Info(l)
+	default:
+		return level.Debug(l)
+	}
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"context"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connection is the IRC connection of one bot account. Each channel is joined
+// by a single connection, the one of the account it chose.
+type connection struct {
+	account string
+	token   string
+	client  *twitch.Client
+	// chat queues the account's messages, since Twitch limits each account
+	// separately.
+	chat      *outbox
+	connected int32
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var (
+	connsMtx sync.RWMutex
+	// conns has a connection for every bot account, by account name.
+	conns = make(map[string]*connection)
+	// defaultAccount chats in channels that haven't chosen an account.
+	defaultAccount string
+	connsWG        sync.WaitGroup
+)
+
+func newConnection(account string, token string) *connection {
+	c := &connection{
+		account: strings.ToLower(account),
+		token:   token,
+		client:  twitch.NewClient(account, "oauth:"+strings.TrimPrefix(token, "oauth:")),
+		done:    make(chan struct{}),
+	}
+	c.chat = newOutbox(c.client.Say)
+
+	c.client.OnNewMessage(handleMessage)
+	c.client.OnConnect(func() {
+		for _, channel := range joinedBy(c) {
+			forgetViewers(channel)
+		}
+		c.setConnected(true)
+	})
+	c.client.OnNewClearchatMessage(handleClearchat)
+	c.client.OnNewUsernoticeMessage(handleUsernotice)
+	// Twitch tells the account whether it moderates a channel on joining and
+	// after each message it sends
+	c.client.OnNewUserstateMessage(func(channel string, user twitch.User, message twitch.Message) {
+		c.chat.setMod(channel, isMod(user))
+	})
+	c.client.OnUserJoin(addViewer)
+	c.client.OnUserPart(removeViewer)
+	return c
+}
+
+func (c *connection) setConnected(connected bool) {
+	var v int32
+	if connected {
+		v = 1
+	}
+	atomic.StoreInt32(&c.connected, v)
+	ircConnected.With("account", c.account).Set(float64(v))
+}
+
+func (c *connection) isConnected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+// run keeps the connection up, reconnecting whenever it drops, until ctx is
+// cancelled. It then parts the account's channels and disconnects.
+func (c *connection) run(ctx context.Context) {
+	defer close(c.done)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.chat.run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			err := c.client.Connect()
+			c.setConnected(false)
+			if ctx.Err() != nil {
+				return
+			}
+
+			level.Error(logger).Log("msg", "disconnected from IRC", "account", c.account, "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+				ircReconnects.Add(1)
+			}
+		}
+	}()
+
+	<-ctx.Done()
+	for _, channel := range joinedBy(c) {
+		c.client.Depart(channel)
+		joinedMtx.Lock()
+		delete(joined, channel)
+		joinedMtx.Unlock()
+	}
+	c.client.Disconnect()
+	wg.Wait()
+}
+
+// startConnection connects an account, until ctx is cancelled or the account
+// is stopped.
+func startConnection(ctx context.Context, account string, token string) {
+	c := newConnection(account, token)
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	connsMtx.Lock()
+	conns[c.account] = c
+	connsMtx.Unlock()
+
+	level.Info(logger).Log("msg", "connecting bot account", "account", c.account)
+	connsWG.Add(1)
+	go func() {
+		defer connsWG.Done()
+		c.run(ctx)
+	}()
+}
+
+// stopConnection disconnects an account. Its channels are joined by their
+// new account on the next sync.
+func stopConnection(account string) {
+	connsMtx.Lock()
+	c, ok := conns[account]
+	delete(conns, account)
+	connsMtx.Unlock()
+	if !ok {
+		return
+	}
+
+	level.Info(logger).Log("msg", "disconnecting bot account", "account", account)
+	c.cancel()
+	<-c.done
+}
+
+// syncAccounts connects the bot accounts in the service, reconnecting those
+// whose token changed and disconnecting removed ones. The default account
+// always stays.
+func syncAccounts(ctx context.Context) {
+	accounts, err := service.ListBotAccount(ctx)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list bot accounts", "err", err)
+		return
+	}
+
+	wanted := make(map[string]string)
+	for _, a := range accounts {
+		if a.Name != defaultAccount {
+			wanted[a.Name] = a.Token
+		}
+	}
+
+	connsMtx.RLock()
+	var stale []string
+	for account, c := range conns {
+		if token, ok := wanted[account]; account != defaultAccount && (!ok || token != c.token) {
+			stale = append(stale, account)
+		}
+	}
+	connsMtx.RUnlock()
+	for _, account := range stale {
+		stopConnection(account)
+	}
+
+	for account, token := range wanted {
+		connsMtx.RLock()
+		_, ok := conns[account]
+		connsMtx.RUnlock()
+		if !ok {
+			startConnection(ctx, account, token)
+		}
+	}
+}
+
+// accountFor returns the connection that should chat in a channel: the one
+// its settings chose, or the default one if that account isn't connected.
+func accountFor(channel string) *connection {
+	account := getSettings(channel).BotAccount
+
+	connsMtx.RLock()
+	defer connsMtx.RUnlock()
+
+	if c, ok := conns[account]; ok && account != "" {
+		return c
+	}
+	return conns[defaultAccount]
+}
+
+// connectionFor returns the connection that joined a channel, or the one that
+// will.
+func connectionFor(channel string) *connection {
+	joinedMtx.Lock()
+	c, ok := joined[channel]
+	joinedMtx.Unlock()
+	if ok {
+		return c
+	}
+	return accountFor(channel)
+}
+
+// joinedBy returns the channels a connection has joined.
+func joinedBy(c *connection) []string {
+	joinedMtx.Lock()
+	defer joinedMtx.Unlock()
+
+	var channels []string
+	for channel, by := range joined {
+		if by == c {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// isBotAccount reports whether a user is one of the bot's accounts.
+func isBotAccount(user string) bool {
+	connsMtx.RLock()
+	defer connsMtx.RUnlock()
+
+	_, ok := conns[strings.ToLower(user)]
+	return ok
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strconv"
+	"strings"
+)
+
+// handleCounter handles the counter command. Anyone can show a counter, mods
+// can change it:
+//
+//	!counter deaths
+//	!counter deaths +1
+//	!counter deaths -1
+//	!counter deaths set 10
+//	!counter deaths reset
+//	!counter deaths delete
+func handleCounter(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	syntax := "Syntax is " + settings.Prefix + "counter <name> [+n|-n|set <n>|reset|delete]."
+	if len(args) < 1 {
+		respond(channel, user, settings, "Not enough args. "+syntax)
+		return
+	}
+	name := args[0]
+
+	if len(args) == 1 {
+		counter, err := service.GetCounter(ctx, channel, name)
+		if err != nil {
+			respond(channel, user, settings, "There's no "+name+" counter.")
+			return
+		}
+		respond(channel, user, settings, fmt.Sprintf("%s: %d", counter.Name, counter.Value))
+		return
+	}
+
+	if !isMod(user) {
+		return
+	}
+
+	var counter claudine_bot.Counter
+	var err error
+	switch op := args[1]; {
+	case op == "set" && len(args) > 2:
+		value, convErr := strconv.Atoi(args[2])
+		if convErr != nil {
+			respond(channel, user, settings, syntax)
+			return
+		}
+		counter, err = withCounter(ctx, channel, name, func() (claudine_bot.Counter, error) {
+			return service.SetCounter(ctx, channel, name, value)
+		})
+	case op == "reset":
+		counter, err = service.ResetCounter(ctx, channel, name)
+	case op == "delete":
+		err = service.DeleteCounter(ctx, channel, name)
+		if err == nil {
+			respond(channel, user, settings, "Counter deleted.")
+			return
+		}
+	case strings.HasPrefix(op, "+") || strings.HasPrefix(op, "-"):
+		delta, convErr := strconv.Atoi(op)
+		if convErr != nil {
+			respond(channel, user, settings, syntax)
+			return
+		}
+		counter, err = withCounter(ctx, channel, name, func() (claudine_bot.Counter, error) {
+			return service.IncrementCounter(ctx, channel, name, delta)
+		})
+	default:
+		respond(channel, user, settings, syntax)
+		return
+	}
+
+	switch err {
+	case nil:
+		respond(channel, user, settings, fmt.Sprintf("%s: %d", counter.Name, counter.Value))
+	case claudine_bot.ErrNotFound:
+		respond(channel, user, settings, "There's no "+name+" counter.")
+	case claudine_bot.ErrInvalidArgument:
+		respond(channel, user, settings, "Counter names can only use letters, numbers, - and _.")
+	default:
+		level.Error(logger).Log("msg", "failed to update counter", "channel", channel, "counter", name, "err", err)
+		respond(channel, user, settings, "Error updating the counter.")
+	}
+}
+
+// withCounter runs fn, creating the counter and trying again if it doesn't exist yet.
+func withCounter(ctx context.Context, channel string, name string, fn func() (claudine_bot.Counter, error)) (claudine_bot.Counter, error) {
+	counter, err := fn()
+	if err != claudine_bot.ErrNotFound {
+		return counter, err
+	}
+
+	if _, err := service.NewCounter(ctx, channel, name); err != nil && err != claudine_bot.ErrAlreadyExist {
+		return claudine_bot.Counter{}, err
+	}
+	return fn()
+}
+
+// counterFunc returns the template function for {{counter "name"}}. Missing
+// counters show as 0.
+func counterFunc(channel string) func(name string) int {
+	return func(name string) int {
+		counter, err := service.GetCounter(context.Background(), channel, name)
+		if err != nil {
+			return 0
+		}
+		return counter.Value
+	}
+}
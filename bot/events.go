@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"github.com/gempir/go-twitch-irc"
+	"github.com/rcole5/claudine-bot"
+	"time"
+)
+
+// Events carries what happens in chat, such as poll votes, to overlays.
+var Events = claudine_bot.NewEventBus()
+
+// Webhooks notifies external services when channels go live or offline and
+// when commands are run. It is set up by the caller, and nothing is sent while
+// it is nil.
+var Webhooks *claudine_bot.WebhookDispatcher
+
+// publish sends an event for a channel to the overlays watching it.
+func publish(channel string, eventType string, data interface{}) {
+	Events.Publish(claudine_bot.Event{
+		Type:    eventType,
+		Channel: channel,
+		Data:    data,
+	})
+}
+
+// notifyCommandExecuted tells the channel's webhooks that a custom command was
+// run.
+func notifyCommandExecuted(channel string, command claudine_bot.Command, user twitch.User) {
+	if Webhooks == nil {
+		return
+	}
+
+	Webhooks.Notify(channel, claudine_bot.WebhookVariables{
+		Event:   claudine_bot.EventCommandExecuted,
+		Channel: channel,
+		URL:     "https://twitch.tv/" + channel,
+		Command: &command,
+		User:    user.Username,
+		Message: user.DisplayName + " ran " + command.Trigger + " in " + channel + ".",
+		Time:    time.Now().UTC(),
+	})
+}
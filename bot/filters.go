@@ -0,0 +1,304 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// How long an offence counts towards the next, harsher penalty.
+	offenceExpiry = time.Hour
+	// How long a banned phrase stays compiled without being used.
+	phraseExpiry = 10 * time.Minute
+)
+
+// linkRegexp matches anything shaped like a link. Without a scheme or www. it
+// is only a link if it ends in one of linkTLDs, so "file.txt" isn't one.
+var linkRegexp = regexp.MustCompile(`(?i)\b(https?://|www\.)?((?:[a-z0-9-]+\.)+[a-z]{2,})\b(?:/\S*)?`)
+
+// linkTLDs are the top level domains links are commonly posted with.
+var linkTLDs = map[string]bool{
+	"app": true, "be": true, "biz": true, "co": true, "com": true, "de": true,
+	"dev": true, "gg": true, "info": true, "io": true, "link": true, "live": true,
+	"ly": true, "me": true, "net": true, "org": true, "ru": true, "shop": true,
+	"site": true, "tk": true, "tv": true, "uk": true, "us": true, "xyz": true,
+}
+
+type offence struct {
+	count int
+	last  time.Time
+}
+
+type cachedPhrase struct {
+	re   *regexp.Regexp
+	used time.Time
+}
+
+var (
+	filterMtx sync.Mutex
+	// permits holds until when a channel/user may post links.
+	permits  = make(map[string]time.Time)
+	offences = make(map[string]offence)
+
+	phraseMtx   sync.Mutex
+	phraseCache = make(map[string]cachedPhrase)
+)
+
+// filterHit is the filter a message broke and the warning shown for it.
+type filterHit struct {
+	filter  string
+	warning string
+}
+
+// moderate checks a message against the channel's filters and punishes the
+// sender if it breaks one. It reports whether the message was filtered.
+func moderate(channel string, user twitch.User, message twitch.Message, settings claudine_bot.ChannelSettings) bool {
+	filters := settings.Filters
+	if filterExempt(user, filters.Exempt) {
+		return false
+	}
+
+	hit, ok := checkFilters(channel, user, message, filters)
+	if !ok {
+		return false
+	}
+
+	penalty := nextPenalty(channel, user.Username, filters.Penalties)
+	action := claudine_bot.ModAction{
+		Type:     claudine_bot.ModActionDelete,
+		Target:   user.Username,
+		Actor:    connectionFor(channel).account,
+		Reason:   "filter: " + hit.filter,
+		Duration: penalty,
+	}
+	if penalty == 0 {
+		say(channel, "/delete "+message.Tags["id"], priorityHigh)
+		say(channel, fmt.Sprintf("@%s %s (warning)", user.DisplayName, hit.warning), priorityNormal)
+	} else {
+		action.Type = claudine_bot.ModActionTimeout
+		say(channel, fmt.Sprintf("/timeout %s %d %s", user.Username, penalty, hit.warning), priorityHigh)
+		say(channel, fmt.Sprintf("@%s %s (timeout %ds)", user.DisplayName, hit.warning, penalty), priorityNormal)
+	}
+	logModAction(channel, action)
+
+	filterActions.With("channel", channel, "filter", hit.filter).Add(1)
+	level.Info(logger).Log("msg", "message filtered", "channel", channel, "user", user.Username, "filter", hit.filter, "timeout", penalty)
+	return true
+}
+
+// filterExempt reports whether the user is never filtered. Mods and the
+// broadcaster always are.
+func filterExempt(user twitch.User, roles []string) bool {
+	if isMod(user) {
+		return true
+	}
+	for _, role := range roles {
+		if _, ok := user.Badges[strings.ToLower(role)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFilters returns the first filter the message breaks.
+func checkFilters(channel string, user twitch.User, message twitch.Message, filters claudine_bot.FilterSettings) (filterHit, bool) {
+	text := message.Text
+
+	for _, phrase := range filters.BannedPhrases {
+		if re := phraseRegexp(phrase); re != nil && re.MatchString(text) {
+			return filterHit{"banned_phrase", "that phrase isn't allowed here."}, true
+		}
+	}
+
+	if filters.Links && !permitted(channel, user.Username) && hasBlockedLink(text, filters.AllowedDomains) {
+		return filterHit{"links", "please ask a mod before posting links."}, true
+	}
+
+	// Emote names are often capitalised, so they don't count as caps or symbols
+	emoteCount := 0
+	for _, emote := range message.Emotes {
+		emoteCount += emote.Count
+		text = strings.Replace(text, emote.Name, "", -1)
+	}
+
+	if filters.MaxEmotes > 0 && emoteCount > filters.MaxEmotes {
+		return filterHit{"emotes", "too many emotes."}, true
+	}
+
+	if filters.CapsRatio > 0 {
+		letters, caps := 0, 0
+		for _, r := range text {
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					caps++
+				}
+			}
+		}
+		if letters >= filters.CapsMinLength && letters > 0 && float64(caps)/float64(letters) > filters.CapsRatio {
+			return filterHit{"caps", "please don't shout."}, true
+		}
+	}
+
+	if filters.SymbolRatio > 0 {
+		chars, symbols := 0, 0
+		for _, r := range text {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			chars++
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				symbols++
+			}
+		}
+		if chars >= filters.SymbolMinLength && chars > 0 && float64(symbols)/float64(chars) > filters.SymbolRatio {
+			return filterHit{"symbols", "too many symbols."}, true
+		}
+	}
+
+	if filters.MaxRepeatedChars > 0 && longestRun(text) > filters.MaxRepeatedChars {
+		return filterHit{"repeated", "please don't spam characters."}, true
+	}
+
+	return filterHit{}, false
+}
+
+// hasBlockedLink reports whether the text links to anywhere not allowed.
+func hasBlockedLink(text string, allowed []string) bool {
+	for _, match := range linkRegexp.FindAllStringSubmatch(text, -1) {
+		host := strings.ToLower(match[2])
+		if match[1] == "" && !linkTLDs[host[strings.LastIndex(host, ".")+1:]] {
+			continue
+		}
+		ok := false
+		for _, domain := range allowed {
+			domain = strings.ToLower(strings.TrimPrefix(domain, "www."))
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// longestRun returns the length of the longest run of one repeated character.
+func longestRun(text string) int {
+	longest, run := 0, 0
+	var last rune
+	for i, r := range text {
+		if i > 0 && r == last {
+			run++
+		} else {
+			run = 1
+		}
+		last = r
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// phraseRegexp compiles a banned phrase once. Invalid phrases are ignored,
+// settings can't be saved with them anyway.
+func phraseRegexp(phrase string) *regexp.Regexp {
+	phraseMtx.Lock()
+	defer phraseMtx.Unlock()
+
+	cached, ok := phraseCache[phrase]
+	if !ok {
+		cached.re, _ = claudine_bot.BannedPhraseRegexp(phrase)
+	}
+	cached.used = time.Now()
+	phraseCache[phrase] = cached
+	return cached.re
+}
+
+// nextPenalty records an offence and returns the timeout for it. Offences
+// expire after an hour without any.
+func nextPenalty(channel string, user string, penalties []int) int {
+	filterMtx.Lock()
+	defer filterMtx.Unlock()
+
+	key := channel + "/" + strings.ToLower(user)
+	o := offences[key]
+	if time.Since(o.last) > offenceExpiry {
+		o.count = 0
+	}
+	o.count++
+	o.last = time.Now()
+	offences[key] = o
+
+	if len(penalties) == 0 {
+		return 0
+	}
+	if o.count > len(penalties) {
+		return penalties[len(penalties)-1]
+	}
+	return penalties[o.count-1]
+}
+
+// pruneFilters forgets expired permits and offences, and phrases that are no
+// longer used.
+func pruneFilters(now time.Time) {
+	filterMtx.Lock()
+	for key, until := range permits {
+		if !now.Before(until) {
+			delete(permits, key)
+		}
+	}
+	for key, o := range offences {
+		if now.Sub(o.last) > offenceExpiry {
+			delete(offences, key)
+		}
+	}
+	filterMtx.Unlock()
+
+	phraseMtx.Lock()
+	for phrase, cached := range phraseCache {
+		if now.Sub(cached.used) > phraseExpiry {
+			delete(phraseCache, phrase)
+		}
+	}
+	phraseMtx.Unlock()
+}
+
+func permitted(channel string, user string) bool {
+	filterMtx.Lock()
+	defer filterMtx.Unlock()
+
+	return time.Now().Before(permits[channel+"/"+strings.ToLower(user)])
+}
+
+// handlePermit lets a user post links for a while. Mods only:
+//
+//	!permit someone
+func handlePermit(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	if len(args) == 0 {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"permit <user>.")
+		return
+	}
+	name := strings.TrimPrefix(args[0], "@")
+	duration := time.Duration(settings.Filters.PermitDuration) * time.Second
+
+	filterMtx.Lock()
+	permits[channel+"/"+strings.ToLower(name)] = time.Now().Add(duration)
+	filterMtx.Unlock()
+
+	respond(channel, user, settings, fmt.Sprintf("%s can post links for %d seconds.", name, settings.Filters.PermitDuration))
+}
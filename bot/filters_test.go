@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"github.com/gempir/go-twitch-irc"
+	"github.com/rcole5/claudine-bot"
+	"testing"
+	"time"
+)
+
+func TestCheckFilters(t *testing.T) {
+	filters := claudine_bot.FilterSettings{
+		Links:            true,
+		AllowedDomains:   []string{"twitch.tv"},
+		CapsRatio:        0.7,
+		CapsMinLength:    10,
+		SymbolRatio:      0.5,
+		SymbolMinLength:  10,
+		MaxEmotes:        3,
+		MaxRepeatedChars: 6,
+		BannedPhrases:    []string{"free gold", "/b+uy followers/"},
+	}
+
+	tests := []struct {
+		name    string
+		message twitch.Message
+		want    string
+	}{
+		{"Clean", twitch.Message{Text: "hello there"}, ""},
+		{"Link", twitch.Message{Text: "go to evil.com/x now"}, "links"},
+		{"AllowedLink", twitch.Message{Text: "clips.twitch.tv/abc is great"}, ""},
+		{"Caps", twitch.Message{Text: "WHY ARE YOU LIKE THIS"}, "caps"},
+		{"ShortCaps", twitch.Message{Text: "GG WP"}, ""},
+		{"Symbols", twitch.Message{Text: "!!!!@@@##$$%%^^ ok"}, "symbols"},
+		{"Repeated", twitch.Message{Text: "noooooooooo"}, "repeated"},
+		{"BannedPhrase", twitch.Message{Text: "get FREE GOLD here"}, "banned_phrase"},
+		{"BannedRegexp", twitch.Message{Text: "want to bbbuy followers?"}, "banned_phrase"},
+		{"TooManyEmotes", twitch.Message{
+			Text:   "LUL LUL LUL LUL",
+			Emotes: []*twitch.Emote{{Name: "LUL", Count: 4}},
+		}, "emotes"},
+		// Emote names don't count as caps
+		{"Emotes", twitch.Message{
+			Text:   "LUL LUL LUL ok",
+			Emotes: []*twitch.Emote{{Name: "LUL", Count: 3}},
+		}, ""},
+	}
+
+	user := twitch.User{Username: "viewer", Badges: map[string]int{}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hit, ok := checkFilters("filters", user, test.message, filters)
+			if ok != (test.want != "") || hit.filter != test.want {
+				t.Fatalf("checkFilters(%q) = %q, %v, want %q", test.message.Text, hit.filter, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestHasBlockedLink(t *testing.T) {
+	tests := []struct {
+		text    string
+		allowed []string
+		want    bool
+	}{
+		{"no links here", nil, false},
+		{"see example.com", nil, true},
+		{"https://example.org/page", nil, true},
+		{"www.example.xyz", nil, true},
+		{"http://end.Then", nil, true},
+		{"open file.txt please", nil, false},
+		{"the end.Then we left", nil, false},
+		{"e.g. this is fine", nil, false},
+		{"twitch.tv/someone", []string{"twitch.tv"}, false},
+		{"clips.twitch.tv/abc", []string{"www.twitch.tv"}, false},
+		{"https://WWW.Twitch.TV/someone", []string{"twitch.tv"}, false},
+		{"nottwitch.tv", []string{"twitch.tv"}, true},
+		{"twitch.tv and evil.com", []string{"twitch.tv"}, true},
+	}
+
+	for _, test := range tests {
+		if got := hasBlockedLink(test.text, test.allowed); got != test.want {
+			t.Errorf("hasBlockedLink(%q, %v) = %v, want %v", test.text, test.allowed, got, test.want)
+		}
+	}
+}
+
+func TestLongestRun(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abc", 1},
+		{"aabbbc", 3},
+		{"noooo way", 4},
+		{"ééé!", 3},
+	}
+
+	for _, test := range tests {
+		if got := longestRun(test.text); got != test.want {
+			t.Errorf("longestRun(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestNextPenalty(t *testing.T) {
+	penalties := []int{0, 60, 600}
+
+	tests := []struct {
+		name string
+		// count offences so far, the last of them this long ago.
+		count int
+		last  time.Duration
+		want  int
+	}{
+		{"First", 0, 0, 0},
+		{"Second", 1, time.Minute, 60},
+		{"Third", 2, time.Minute, 600},
+		{"PastLast", 5, time.Minute, 600},
+		{"Expired", 2, 2 * offenceExpiry, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channel := "penalty" + test.name
+			if test.count > 0 {
+				filterMtx.Lock()
+				offences[channel+"/viewer"] = offence{count: test.count, last: time.Now().Add(-test.last)}
+				filterMtx.Unlock()
+			}
+
+			// Usernames are matched without case
+			if got := nextPenalty(channel, "Viewer", penalties); got != test.want {
+				t.Fatalf("nextPenalty() = %d, want %d", got, test.want)
+			}
+		})
+	}
+
+	if got := nextPenalty("penaltyNone", "viewer", nil); got != 0 {
+		t.Fatalf("nextPenalty() without penalties = %d, want 0", got)
+	}
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nicklaw5/helix"
+	"github.com/rcole5/claudine-bot"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long the result of a Helix reachability check is reused for.
+const helixCheckTTL = 30 * time.Second
+
+var (
+	ErrNotConnected = claudine_bot.ErrNotConnected
+	ErrNoHelix      = errors.New("helix client not initialised")
+
+	helixCheckMtx     sync.Mutex
+	helixCheckErr     error
+	helixCheckExpires time.Time
+)
+
+// Connected reports whether the default bot account is currently connected to
+// IRC. The other accounts keep reconnecting on their own and are reported by
+// the claudine_irc_connected metric instead.
+func Connected() bool {
+	connsMtx.RLock()
+	defer connsMtx.RUnlock()
+
+	c, ok := conns[defaultAccount]
+	return ok && c.isConnected()
+}
+
+// CheckIRC is a health check for the IRC connection.
+func CheckIRC(ctx context.Context) error {
+	if !Connected() {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// CheckHelix is a health check for Helix reachability. Results are cached so
+// frequent probes don't eat into the rate limit.
+func CheckHelix(ctx context.Context) error {
+	helixCheckMtx.Lock()
+	defer helixCheckMtx.Unlock()
+
+	if time.Now().Before(helixCheckExpires) {
+		return helixCheckErr
+	}
+
+	helixCheckErr = checkHelix()
+	helixCheckExpires = time.Now().Add(helixCheckTTL)
+	return helixCheckErr
+}
+
+func checkHelix() error {
+	if HelixClient == nil {
+		return ErrNoHelix
+	}
+
+	resp, err := getStreams(&helix.StreamsParams{First: 1})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("helix returned %d: %s", resp.StatusCode, resp.ErrorMessage)
+	}
+	return nil
+}
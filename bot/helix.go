@@ -0,0 +1,255 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/nicklaw5/helix"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// getStreams wraps HelixClient.GetStreams with metrics.
+func getStreams(params *helix.StreamsParams) (*helix.StreamsResponse, error) {
+	begin := time.Now()
+	resp, err := HelixClient.GetStreams(params)
+	observeHelix("streams", begin, err)
+	return resp, err
+}
+
+// getGames wraps HelixClient.GetGames with metrics.
+func getGames(params *helix.GamesParams) (*helix.GamesResponse, error) {
+	begin := time.Now()
+	resp, err := HelixClient.GetGames(params)
+	observeHelix("games", begin, err)
+	return resp, err
+}
+
+// currentGame returns the name of the game a channel is streaming, or an empty
+// string if it isn't live.
+func currentGame(channel string) (string, error) {
+	stream, live, err := streamInfo(channel)
+	if err != nil || !live || stream.GameID == "" {
+		return "", err
+	}
+
+	return gameName(stream.GameID)
+}
+
+// gameName looks up the name of a game by its id.
+func gameName(id string) (string, error) {
+	games, err := getGames(&helix.GamesParams{
+		IDs: []string{id},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(games.Data.Games) == 0 {
+		return "", nil
+	}
+	return games.Data.Games[0].Name, nil
+}
+
+// getUsers wraps HelixClient.GetUsers with metrics.
+func getUsers(params *helix.UsersParams) (*helix.UsersResponse, error) {
+	begin := time.Now()
+	resp, err := HelixClient.GetUsers(params)
+	observeHelix("users", begin, err)
+	return resp, err
+}
+
+// getUsersFollows wraps HelixClient.GetUsersFollows with metrics.
+func getUsersFollows(params *helix.UsersFollowsParams) (*helix.UsersFollowsResponse, error) {
+	begin := time.Now()
+	resp, err := HelixClient.GetUsersFollows(params)
+	observeHelix("users_follows", begin, err)
+	return resp, err
+}
+
+// searchChannels wraps HelixClient.SearchChannels with metrics.
+func searchChannels(params *helix.SearchChannelsParams) (*helix.SearchChannelsResponse, error) {
+	begin := time.Now()
+	resp, err := HelixClient.SearchChannels(params)
+	observeHelix("search_channels", begin, err)
+	return resp, err
+}
+
+// userID looks up the id of a user by their login, or an empty string if there
+// is no such user.
+func userID(login string) (string, error) {
+	users, err := getUsers(&helix.UsersParams{
+		Logins: []string{login},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(users.Data.Users) == 0 {
+		return "", nil
+	}
+	return users.Data.Users[0].ID, nil
+}
+
+// searchChannel finds a channel by its login, live or not.
+func searchChannel(login string) (helix.Channel, bool, error) {
+	channels, err := searchChannels(&helix.SearchChannelsParams{
+		Channel: login,
+		First:   20,
+	})
+	if err != nil {
+		return helix.Channel{}, false, err
+	}
+
+	// Search is fuzzy, so look for the exact channel
+	for _, c := range channels.Data.Channels {
+		if strings.EqualFold(c.DisplayName, login) {
+			return c, true, nil
+		}
+	}
+	return helix.Channel{}, false, nil
+}
+
+// lastGame returns the display name of a channel and the game it last
+// streamed, live or not. Both are empty if the channel doesn't exist.
+func lastGame(login string) (string, string, error) {
+	c, ok, err := searchChannel(login)
+	if err != nil || !ok {
+		return "", "", err
+	}
+	if c.GameID == "" {
+		return c.DisplayName, "", nil
+	}
+
+	game, err := gameName(c.GameID)
+	return c.DisplayName, game, err
+}
+
+// gameID looks up the id of a game by its exact name.
+func gameID(name string) (string, error) {
+	games, err := getGames(&helix.GamesParams{
+		Names: []string{name},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(games.Data.Games) == 0 {
+		return "", nil
+	}
+	return games.Data.Games[0].ID, nil
+}
+
+// followedAt returns when one user followed a channel.
+func followedAt(user string, channel string) (time.Time, bool, error) {
+	users, err := getUsers(&helix.UsersParams{
+		Logins: []string{user, channel},
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var fromID, toID string
+	for _, u := range users.Data.Users {
+		if strings.EqualFold(u.Login, user) {
+			fromID = u.ID
+		}
+		if strings.EqualFold(u.Login, channel) {
+			toID = u.ID
+		}
+	}
+	if fromID == "" || toID == "" {
+		return time.Time{}, false, nil
+	}
+
+	follows, err := getUsersFollows(&helix.UsersFollowsParams{
+		FromID: fromID,
+		ToID:   toID,
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(follows.Data.Follows) == 0 {
+		return time.Time{}, false, nil
+	}
+	return follows.Data.Follows[0].FollowedAt, true, nil
+}
+
+// The helix package doesn't cover every endpoint yet, those are called here
+// directly.
+const helixURL = "https://api.twitch.tv/helix"
+
+var helixHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// helixRequest calls a Helix endpoint, sending body as JSON if it isn't nil
+// and decoding the response into out if it isn't nil. The token is optional.
+func helixRequest(endpoint string, method string, path string, token string, body interface{}, out interface{}) (err error) {
+	defer func(begin time.Time) { observeHelix(endpoint, begin, err) }(time.Now())
+
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, helixURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Client-ID", os.Getenv("CLIENT_ID"))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := helixHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("helix %s returned %s", path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// accountCreated returns when a user's account was made.
+func accountCreated(login string) (time.Time, bool, error) {
+	var body struct {
+		Data []struct {
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	err := helixRequest("users", http.MethodGet, "/users?login="+url.QueryEscape(login), "", nil, &body)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(body.Data) == 0 {
+		return time.Time{}, false, nil
+	}
+	return body.Data[0].CreatedAt, true, nil
+}
+
+// channelUpdate holds the channel fields to change. Empty fields are left as
+// they are.
+type channelUpdate struct {
+	Title  string `json:"title,omitempty"`
+	GameID string `json:"game_id,omitempty"`
+}
+
+// modifyChannel updates a channel with the broadcaster's token, which needs
+// the channel:manage:broadcast scope.
+func modifyChannel(broadcasterID string, token string, update channelUpdate) error {
+	path := "/channels?broadcaster_id=" + url.QueryEscape(broadcasterID)
+	return helixRequest("modify_channel", http.MethodPatch, path, token, update, nil)
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"fmt"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+var (
+	messagesSeen = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "bot",
+		Name:      "messages_seen_total",
+		Help:      "Number of chat messages seen.",
+	}, []string{"channel"})
+
+	commandsExecuted = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "bot",
+		Name:      "commands_executed_total",
+		Help:      "Number of commands executed.",
+	}, []string{"channel", "command"})
+
+	repeatPosts = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "bot",
+		Name:      "repeat_posts_total",
+		Help:      "Number of repeat commands posted.",
+	}, []string{"channel"})
+
+	messagesSent = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "bot",
+		Name:      "messages_sent_total",
+		Help:      "Number of chat messages sent.",
+	}, []string{"channel"})
+
+	messagesDropped = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "bot",
+		Name:      "messages_dropped_total",
+		Help:      "Number of chat messages dropped instead of sent.",
+	}, []string{"channel", "reason"})
+
+	helixCalls = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "helix",
+		Name:      "calls_total",
+		Help:      "Number of calls made to the Helix API.",
+	}, []string{"endpoint", "error"})
+
+	helixLatency = kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "claudine",
+		Subsystem: "helix",
+		Name:      "call_duration_seconds",
+		Help:      "Duration of calls to the Helix API in seconds.",
+	}, []string{"endpoint"})
+
+	filterActions = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "bot",
+		Name:      "filtered_messages_total",
+		Help:      "Number of chat messages caught by a moderation filter.",
+	}, []string{"channel", "filter"})
+
+	ircReconnects = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "claudine",
+		Subsystem: "irc",
+		Name:      "reconnects_total",
+		Help:      "Number of times the IRC connection was re-established.",
+	}, []string{})
+
+	ircConnected = kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "claudine",
+		Subsystem: "irc",
+		Name:      "connected",
+		Help:      "Whether each bot account is connected to IRC, 1 if it is.",
+	}, []string{"account"})
+)
+
+// observeHelix records a call to a Helix endpoint.
+func observeHelix(endpoint string, begin time.Time, err error) {
+	helixCalls.With("endpoint", endpoint, "error", fmt.Sprint(err != nil)).Add(1)
+	helixLatency.With("endpoint", endpoint).Observe(time.Since(begin).Seconds())
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long after the bot times someone out the CLEARCHAT for it is ignored, so
+// the action isn't logged twice.
+const ownActionWindow = 10 * time.Second
+
+var (
+	ownActionsMtx sync.Mutex
+	ownActions    = make(map[string]time.Time)
+)
+
+var tagUnescaper = strings.NewReplacer(`\s`, " ", `\:`, ";", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+
+// logModAction records a moderation action in the channel's ledger.
+func logModAction(channel string, action claudine_bot.ModAction) {
+	if action.Type == claudine_bot.ModActionTimeout || action.Type == claudine_bot.ModActionBan {
+		ownActionsMtx.Lock()
+		ownActions[channel+"/"+strings.ToLower(action.Target)] = time.Now()
+		ownActionsMtx.Unlock()
+	}
+
+	if _, err := service.LogModAction(context.Background(), channel, action); err != nil {
+		level.Error(logger).Log("msg", "failed to log moderation action", "channel", channel, "target", action.Target, "err", err)
+	}
+}
+
+// handleClearchat logs timeouts and bans made by mods in chat. Twitch doesn't
+// say which mod it was.
+func handleClearchat(channel string, user twitch.User, message twitch.Message) {
+	// A clear of the whole chat has no target
+	if user.Username == "" {
+		return
+	}
+
+	key := channel + "/" + strings.ToLower(user.Username)
+	ownActionsMtx.Lock()
+	own := time.Since(ownActions[key]) < ownActionWindow
+	delete(ownActions, key)
+	ownActionsMtx.Unlock()
+	if own {
+		return
+	}
+
+	action := claudine_bot.ModAction{
+		Type:   claudine_bot.ModActionBan,
+		Target: user.Username,
+		Reason: tagUnescaper.Replace(message.Tags["ban-reason"]),
+	}
+	if duration, err := strconv.Atoi(message.Tags["ban-duration"]); err == nil {
+		action.Type = claudine_bot.ModActionTimeout
+		action.Duration = duration
+	}
+	logModAction(channel, action)
+}
+
+// handleWarn gives a user a warning. Mods only:
+//
+//	!warn someone [reason]
+func handleWarn(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	if len(args) == 0 {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"warn <user> [reason].")
+		return
+	}
+	target := strings.TrimPrefix(args[0], "@")
+
+	_, err := service.LogModAction(ctx, channel, claudine_bot.ModAction{
+		Type:   claudine_bot.ModActionWarning,
+		Target: target,
+		Actor:  user.Username,
+		Reason: strings.Join(args[1:], " "),
+	})
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to warn", "channel", channel, "target", target, "err", err)
+		respond(channel, user, settings, "Error warning "+target+".")
+		return
+	}
+
+	warnings, err := service.ListModAction(ctx, channel, claudine_bot.ModActionQuery{
+		Target: target,
+		Type:   claudine_bot.ModActionWarning,
+	})
+	if err != nil {
+		respond(channel, user, settings, "@"+target+" you've been warned.")
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("@%s you've been warned (%d so far).", target, len(warnings)))
+}
+
+// handleWarnings sums up a user's moderation history. Mods only:
+//
+//	!warnings someone
+func handleWarnings(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	if len(args) == 0 {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"warnings <user>.")
+		return
+	}
+	target := strings.TrimPrefix(args[0], "@")
+
+	actions, err := service.ListModAction(ctx, channel, claudine_bot.ModActionQuery{Target: target})
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list moderation actions", "channel", channel, "target", target, "err", err)
+		return
+	}
+	if len(actions) == 0 {
+		respond(channel, user, settings, target+" has a clean record.")
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, action := range actions {
+		counts[action.Type]++
+	}
+	text := fmt.Sprintf("%s has %d warnings, %d timeouts, %d deletes and %d bans.", target,
+		counts[claudine_bot.ModActionWarning], counts[claudine_bot.ModActionTimeout],
+		counts[claudine_bot.ModActionDelete], counts[claudine_bot.ModActionBan])
+
+	// Actions are newest first
+	if last := actions[0]; last.Reason != "" {
+		text += fmt.Sprintf(" Last %s: %s", last.Type, last.Reason)
+	}
+	respond(channel, user, settings, text)
+}
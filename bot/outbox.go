@@ -0,0 +1,284 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Twitch allows an account 20 messages every 30 seconds, or 100 in channels it
+// moderates, and one message a second in a channel it doesn't. Identical
+// messages within 30 seconds are rejected in channels it doesn't moderate.
+const (
+	chatWindow      = 30 * time.Second
+	chatLimit       = 20
+	modChatLimit    = 100
+	channelInterval = time.Second
+
+	// How long a low priority message can wait before it's dropped.
+	lowPriorityTTL = 10 * time.Second
+	// Most messages waiting to be sent.
+	outboxSize = 200
+)
+
+// priority decides which messages go first when chat is busy.
+type priority int
+
+const (
+	// priorityLow is for messages nobody asked for, such as repeats. They're
+	// dropped rather than sent late.
+	priorityLow priority = iota
+	// priorityNormal is for replies and announcements.
+	priorityNormal
+	// priorityHigh is for moderation, which goes ahead of everything.
+	priorityHigh
+)
+
+// tokenBucket holds up to capacity tokens, refilled evenly over a period.
+type tokenBucket struct {
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, period time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		rate:     float64(capacity) / period.Seconds(),
+		tokens:   float64(capacity),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is free, 0 if one is now.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take uses up a token, if there is one.
+func (b *tokenBucket) take(now time.Time) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		b.tokens = 0
+	}
+}
+
+type outboundMessage struct {
+	channel  string
+	text     string
+	priority priority
+	queued   time.Time
+}
+
+// outbox queues everything an account says and sends it as fast as Twitch
+// allows.
+type outbox struct {
+	mtx sync.Mutex
+	// queue is ordered by priority, then by when messages were queued.
+	queue    []outboundMessage
+	global   *tokenBucket
+	modOnly  *tokenBucket
+	channels map[string]*tokenBucket
+	mods     map[string]bool
+	// recent is when each channel's messages were last queued, to drop
+	// duplicates.
+	recent map[string]time.Time
+
+	send func(channel string, text string)
+	wake chan struct{}
+}
+
+func newOutbox(send func(channel string, text string)) *outbox {
+	return &outbox{
+		global:   newTokenBucket(chatLimit, chatWindow),
+		modOnly:  newTokenBucket(modChatLimit, chatWindow),
+		channels: make(map[string]*tokenBucket),
+		mods:     make(map[string]bool),
+		recent:   make(map[string]time.Time),
+		send:     send,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// say queues a message for a channel, to be sent by the account that chats
+// there.
+func say(channel string, text string, p priority) {
+	c := connectionFor(channel)
+	if c == nil {
+		messagesDropped.With("channel", channel, "reason", "no_account").Add(1)
+		return
+	}
+	c.chat.add(channel, text, p, time.Now())
+}
+
+func (o *outbox) setMod(channel string, mod bool) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	o.mods[strings.ToLower(channel)] = mod
+}
+
+// add queues a message unless it duplicates a recent one or the queue is full
+// of more important ones.
+func (o *outbox) add(channel string, text string, p priority, now time.Time) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	key := strings.ToLower(channel) + "\n" + text
+	if last, ok := o.recent[key]; ok && now.Sub(last) < chatWindow && !o.mods[strings.ToLower(channel)] {
+		messagesDropped.With("channel", channel, "reason", "duplicate").Add(1)
+		return
+	}
+
+	if len(o.queue) >= outboxSize {
+		// Make room by dropping the newest of the least important messages
+		last := o.queue[len(o.queue)-1]
+		if last.priority >= p {
+			messagesDropped.With("channel", channel, "reason", "full").Add(1)
+			return
+		}
+		o.queue = o.queue[:len(o.queue)-1]
+		messagesDropped.With("channel", last.channel, "reason", "full").Add(1)
+	}
+	o.recent[key] = now
+
+	i := len(o.queue)
+	for i > 0 && o.queue[i-1].priority < p {
+		i--
+	}
+	o.queue = append(o.queue, outboundMessage{})
+	copy(o.queue[i+1:], o.queue[i:])
+	o.queue[i] = outboundMessage{channel: channel, text: text, priority: p, queued: now}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends queued messages until ctx is cancelled.
+func (o *outbox) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		wait := o.next(time.Now())
+		if wait == 0 {
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait > 0 {
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next sends the first message that the limits allow. It returns 0 if one
+// was sent, how long until one can be otherwise, or -1 if the queue is empty.
+func (o *outbox) next(now time.Time) time.Duration {
+	o.mtx.Lock()
+
+	o.prune(now)
+	if len(o.queue) == 0 {
+		o.mtx.Unlock()
+		return -1
+	}
+
+	wait := time.Duration(-1)
+	for i, m := range o.queue {
+		channel := strings.ToLower(m.channel)
+		mod := o.mods[channel]
+
+		d := o.modOnly.wait(now)
+		if !mod {
+			if w := o.global.wait(now); w > d {
+				d = w
+			}
+			if w := o.channelBucket(channel).wait(now); w > d {
+				d = w
+			}
+		}
+		if d > 0 {
+			if wait < 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		// Every message counts against the lower limit, even where it
+		// doesn't apply
+		o.modOnly.take(now)
+		o.global.take(now)
+		if !mod {
+			o.channelBucket(channel).take(now)
+		}
+		o.queue = append(o.queue[:i], o.queue[i+1:]...)
+		o.mtx.Unlock()
+
+		o.send(m.channel, m.text)
+		messagesSent.With("channel", m.channel).Add(1)
+		return 0
+	}
+
+	o.mtx.Unlock()
+	return wait
+}
+
+// prune drops low priority messages that waited too long and forgets old
+// messages.
+func (o *outbox) prune(now time.Time) {
+	queue := o.queue[:0]
+	for _, m := range o.queue {
+		if m.priority == priorityLow && now.Sub(m.queued) > lowPriorityTTL {
+			messagesDropped.With("channel", m.channel, "reason", "expired").Add(1)
+			continue
+		}
+		queue = append(queue, m)
+	}
+	o.queue = queue
+
+	for key, last := range o.recent {
+		if now.Sub(last) >= chatWindow {
+			delete(o.recent, key)
+		}
+	}
+}
+
+func (o *outbox) channelBucket(channel string) *tokenBucket {
+	b, ok := o.channels[channel]
+	if !ok {
+		b = newTokenBucket(1, channelInterval)
+		o.channels[channel] = b
+	}
+	return b
+}
@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name string
+		// take tokens at start, then wait from after.
+		take  int
+		after time.Duration
+		want  time.Duration
+	}{
+		{"Full", 0, 0, 0},
+		{"LastToken", 19, 0, 0},
+		{"Empty", 20, 0, 1500 * time.Millisecond},
+		{"PartlyRefilled", 20, 500 * time.Millisecond, time.Second},
+		{"Refilled", 20, 1500 * time.Millisecond, 0},
+		{"CappedAtCapacity", 20, time.Hour, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTokenBucket(chatLimit, chatWindow)
+			for i := 0; i < test.take; i++ {
+				b.take(start)
+			}
+			if got := b.wait(start.Add(test.after)); got != test.want {
+				t.Fatalf("wait() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// Refilling never holds more than the capacity
+	b := newTokenBucket(chatLimit, chatWindow)
+	b.take(start)
+	b.wait(start.Add(time.Hour))
+	for i := 0; i < chatLimit; i++ {
+		b.take(start.Add(time.Hour))
+	}
+	if got := b.wait(start.Add(time.Hour)); got == 0 {
+		t.Fatalf("wait() after taking %d tokens = 0, want the bucket empty", chatLimit)
+	}
+}
+
+func TestOutboxDuplicates(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		mod     bool
+		channel string
+		text    string
+		after   time.Duration
+		want    int
+	}{
+		{"Duplicate", false, "channel", "hello", time.Second, 1},
+		{"OtherCase", false, "Channel", "hello", time.Second, 1},
+		{"OtherText", false, "channel", "hello!", time.Second, 2},
+		{"OtherChannel", false, "other", "hello", time.Second, 2},
+		{"AfterWindow", false, "channel", "hello", chatWindow, 2},
+		// Twitch lets moderators repeat themselves
+		{"Mod", true, "channel", "hello", time.Second, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOutbox(func(string, string) {})
+			o.setMod("channel", test.mod)
+			o.add("channel", "hello", priorityNormal, now)
+			o.add(test.channel, test.text, priorityNormal, now.Add(test.after))
+			if len(o.queue) != test.want {
+				t.Fatalf("queued %d messages, want %d", len(o.queue), test.want)
+			}
+		})
+	}
+}
+
+func TestOutboxFull(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		fill priority
+		add  priority
+		// want is the last message in the queue afterwards.
+		want string
+	}{
+		{"DropsLessImportant", priorityLow, priorityNormal, fmt.Sprint(outboxSize - 2)},
+		{"HighOverNormal", priorityNormal, priorityHigh, fmt.Sprint(outboxSize - 2)},
+		{"DropsSame", priorityNormal, priorityNormal, fmt.Sprint(outboxSize - 1)},
+		{"DropsLess", priorityHigh, priorityLow, fmt.Sprint(outboxSize - 1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOutbox(func(string, string) {})
+			for i := 0; i < outboxSize; i++ {
+				o.add("channel", fmt.Sprint(i), test.fill, now)
+			}
+			o.add("channel", "new", test.add, now)
+
+			if len(o.queue) != outboxSize {
+				t.Fatalf("queued %d messages, want %d", len(o.queue), outboxSize)
+			}
+			if last := o.queue[outboxSize-1].text; last != test.want {
+				t.Fatalf("last queued message = %q, want %q", last, test.want)
+			}
+			if (test.add > test.fill) != (o.queue[0].text == "new") {
+				t.Fatalf("first queued message = %q", o.queue[0].text)
+			}
+		})
+	}
+}
+
+func TestOutboxNext(t *testing.T) {
+	var sent []string
+	o := newOutbox(func(channel string, text string) { sent = append(sent, channel+": "+text) })
+	now := time.Now()
+
+	o.add("channel", "repeat", priorityLow, now)
+	o.add("channel", "reply", priorityNormal, now)
+	o.add("channel", "/timeout someone", priorityHigh, now)
+	o.add("other", "hi", priorityLow, now)
+
+	steps := []struct {
+		after time.Duration
+		// want is what's sent, if anything.
+		want string
+	}{
+		{0, "channel: /timeout someone"},
+		// One message a second per channel, but other channels go meanwhile
+		{0, "other: hi"},
+		{0, ""},
+		{channelInterval, "channel: reply"},
+		// Low priority messages are dropped when they wait too long
+		{lowPriorityTTL + channelInterval, ""},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.after)
+		n := len(sent)
+		wait := o.next(now)
+		if step.want == "" {
+			if len(sent) != n {
+				t.Fatalf("step %d sent %q, want nothing", i, sent[n])
+			}
+			continue
+		}
+		if wait != 0 || len(sent) != n+1 || sent[n] != step.want {
+			t.Fatalf("step %d sent %q, want %q", i, sent[n:], step.want)
+		}
+	}
+	if len(o.queue) != 0 {
+		t.Fatalf("queue = %v, want it empty", o.queue)
+	}
+
+	// Channels the bot moderates share the higher account limit only
+	mod := newOutbox(func(string, string) {})
+	mod.setMod("channel", true)
+	for i := 0; i < modChatLimit+10; i++ {
+		mod.add("channel", fmt.Sprint(i), priorityNormal, now)
+	}
+	sentMod := 0
+	for mod.next(now) == 0 {
+		sentMod++
+	}
+	if sentMod != modChatLimit {
+		t.Fatalf("sent %d messages as a mod, want %d", sentMod, modChatLimit)
+	}
+	mod.add("other", "hi", priorityHigh, now)
+	if wait := mod.next(now); wait <= 0 {
+		t.Fatalf("next() in another channel = %v, want a wait", wait)
+	}
+}
@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chattersURL lists everyone connected to a channel's chat, including lurkers
+// that IRC membership doesn't report reliably.
+const chattersURL = "https://tmi.twitch.tv/group/user/%s/chatters"
+
+var (
+	// viewers tracks who is present in each channel from JOIN, PART and chat.
+	viewersMtx sync.Mutex
+	viewers    = make(map[string]map[string]struct{})
+
+	chattersClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+func addViewer(channel string, user string) {
+	viewersMtx.Lock()
+	defer viewersMtx.Unlock()
+
+	if viewers[channel] == nil {
+		viewers[channel] = make(map[string]struct{})
+	}
+	viewers[channel][strings.ToLower(user)] = struct{}{}
+}
+
+func removeViewer(channel string, user string) {
+	viewersMtx.Lock()
+	defer viewersMtx.Unlock()
+
+	delete(viewers[channel], strings.ToLower(user))
+}
+
+// forgetViewers forgets everyone in a channel, the JOINs are replayed after
+// reconnecting.
+func forgetViewers(channel string) {
+	viewersMtx.Lock()
+	defer viewersMtx.Unlock()
+
+	delete(viewers, channel)
+}
+
+// presentViewers returns the viewers seen in chat merged with the chatters list.
+func presentViewers(channel string) []string {
+	present := make(map[string]struct{})
+
+	chatters, err := getChatters(channel)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to get chatters", "channel", channel, "err", err)
+	}
+	for _, user := range chatters {
+		present[user] = struct{}{}
+	}
+
+	viewersMtx.Lock()
+	for user := range viewers[channel] {
+		present[user] = struct{}{}
+	}
+	viewersMtx.Unlock()
+
+	// The bot doesn't earn points
+	var users []string
+	for user := range present {
+		if !isBotAccount(user) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// getChatters fetches the users connected to a channel's chat.
+func getChatters(channel string) ([]string, error) {
+	resp, err := chattersClient.Get(fmt.Sprintf(chattersURL, channel))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chatters returned %s", resp.Status)
+	}
+
+	var body struct {
+		Chatters map[string][]string `json:"chatters"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, group := range body.Chatters {
+		users = append(users, group...)
+	}
+	return users, nil
+}
+
+// awardPoints gives the present viewers of each live channel their points for
+// the last minute.
+func awardPoints(ctx context.Context) {
+	channels, err := service.ListChannel(ctx)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list channels", "err", err)
+		return
+	}
+
+	for _, channel := range channels {
+		settings := getSettings(string(channel))
+		if !settings.BuiltinEnabled("points") || !isChannelLive(string(channel)) {
+			continue
+		}
+
+		users := presentViewers(string(channel))
+		if len(users) == 0 {
+			continue
+		}
+
+		if err := service.AddPoints(ctx, string(channel), users, settings.PointsPerMinute); err != nil {
+			level.Error(logger).Log("msg", "failed to award points", "channel", channel, "err", err)
+		}
+	}
+}
+
+// handlePoints shows the balance of the user or the named user:
+//
+//	!points
+//	!points someone
+func handlePoints(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	name := user.Username
+	if len(args) > 0 {
+		name = strings.TrimPrefix(args[0], "@")
+	}
+
+	points, err := service.GetPoints(ctx, channel, name)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get points", "channel", channel, "user", name, "err", err)
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("%s has %d points.", name, points.Balance))
+}
+
+// handleGive moves points from the user to someone else:
+//
+//	!give someone 100
+func handleGive(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	syntax := "Syntax is " + settings.Prefix + "give <user> <amount>."
+	if len(args) < 2 {
+		respond(channel, user, settings, "Not enough args. "+syntax)
+		return
+	}
+	to := strings.TrimPrefix(args[0], "@")
+	amount, err := strconv.Atoi(args[1])
+	if err != nil {
+		respond(channel, user, settings, syntax)
+		return
+	}
+
+	switch err := service.GivePoints(ctx, channel, user.Username, to, amount); err {
+	case nil:
+		respond(channel, user, settings, fmt.Sprintf("Gave %d points to %s.", amount, to))
+	case claudine_bot.ErrInsufficientPoints:
+		respond(channel, user, settings, "You don't have enough points.")
+	case claudine_bot.ErrInvalidArgument:
+		respond(channel, user, settings, syntax)
+	default:
+		level.Error(logger).Log("msg", "failed to give points", "channel", channel, "err", err)
+	}
+}
+
+// handleAddPoints adds points to a user, a negative amount takes them away.
+// Mods only:
+//
+//	!addpoints someone 100
+func handleAddPoints(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+
+	syntax := "Syntax is " + settings.Prefix + "addpoints <user> <amount>."
+	if len(args) < 2 {
+		respond(channel, user, settings, "Not enough args. "+syntax)
+		return
+	}
+	to := strings.TrimPrefix(args[0], "@")
+	amount, err := strconv.Atoi(args[1])
+	if err != nil {
+		respond(channel, user, settings, syntax)
+		return
+	}
+
+	if err := service.AddPoints(ctx, channel, []string{to}, amount); err != nil {
+		level.Error(logger).Log("msg", "failed to add points", "channel", channel, "err", err)
+		respond(channel, user, settings, "Error adding points.")
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("Added %d points to %s.", amount, to))
+}
+
+// pointsFunc returns the template function for {{points}}, the balance of the
+// user running the command.
+func pointsFunc(channel string, user twitch.User) func() int {
+	return func() int {
+		if user.Username == "" {
+			return 0
+		}
+		points, err := service.GetPoints(context.Background(), channel, user.Username)
+		if err != nil {
+			return 0
+		}
+		return points.Balance
+	}
+}
@@ -0,0 +1,204 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a poll runs if the mod doesn't give a duration.
+const pollDuration = 2 * time.Minute
+
+var (
+	// pollDeadlines holds when the open poll of each channel should close.
+	pollMtx       sync.Mutex
+	pollDeadlines = make(map[string]time.Time)
+)
+
+// trackPoll schedules an open poll to be closed when it ends.
+func trackPoll(channel string, poll claudine_bot.Poll) {
+	pollMtx.Lock()
+	defer pollMtx.Unlock()
+
+	if poll.Open {
+		pollDeadlines[channel] = poll.EndsAt
+	} else {
+		delete(pollDeadlines, channel)
+	}
+}
+
+// trackOpenPoll picks up a poll left open by a restart.
+func trackOpenPoll(ctx context.Context, channel string) {
+	poll, err := service.CurrentPoll(ctx, channel)
+	if err != nil {
+		return
+	}
+	trackPoll(channel, poll)
+}
+
+// closeExpiredPolls closes the polls that have ended and announces the results.
+func closeExpiredPolls(ctx context.Context) {
+	var expired []string
+	pollMtx.Lock()
+	for channel, deadline := range pollDeadlines {
+		if time.Now().After(deadline) {
+			expired = append(expired, channel)
+			delete(pollDeadlines, channel)
+		}
+	}
+	pollMtx.Unlock()
+
+	for _, channel := range expired {
+		poll, err := service.CurrentPoll(ctx, channel)
+		if err != nil || !poll.Open {
+			continue
+		}
+		endPoll(ctx, channel, poll)
+	}
+}
+
+// endPoll closes a poll and announces the results.
+func endPoll(ctx context.Context, channel string, poll claudine_bot.Poll) {
+	closed, err := service.ClosePoll(ctx, channel, poll.ID)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to close poll", "channel", channel, "poll", poll.ID, "err", err)
+		return
+	}
+	poll = closed
+	trackPoll(channel, poll)
+	publish(channel, "poll_ended", poll)
+
+	text := "Poll closed with no votes."
+	if winners := poll.Winners(); len(winners) > 0 {
+		var names []string
+		for _, i := range winners {
+			names = append(names, poll.Options[i])
+		}
+		text = fmt.Sprintf("Poll closed! %s: %s wins with %d votes.", poll.Question, strings.Join(names, " & "), poll.Tally[winners[0]])
+	}
+	respond(channel, twitch.User{}, getSettings(channel), text)
+}
+
+// formatPoll lists each option with its number and votes.
+func formatPoll(poll claudine_bot.Poll) string {
+	var options []string
+	for i, option := range poll.Options {
+		options = append(options, fmt.Sprintf("%d) %s - %d", i+1, option, poll.Tally[i]))
+	}
+	return poll.Question + " " + strings.Join(options, ", ")
+}
+
+// parsePoll reads a poll from [duration] "Question" option1 | option2.
+func parsePoll(text string) (claudine_bot.Poll, bool) {
+	duration := pollDuration
+	text = strings.TrimSpace(text)
+	if i := strings.Index(text, " "); i > 0 {
+		if d, err := time.ParseDuration(text[:i]); err == nil && d > 0 {
+			duration = d
+			text = strings.TrimSpace(text[i+1:])
+		}
+	}
+
+	if !strings.HasPrefix(text, "\"") {
+		return claudine_bot.Poll{}, false
+	}
+	end := strings.Index(text[1:], "\"")
+	if end < 0 {
+		return claudine_bot.Poll{}, false
+	}
+
+	return claudine_bot.Poll{
+		Question: text[1 : end+1],
+		Options:  strings.Split(text[end+2:], "|"),
+		EndsAt:   time.Now().Add(duration),
+	}, true
+}
+
+// handlePoll handles the poll command. Anyone can see the results, mods run
+// polls:
+//
+//	!poll
+//	!poll [duration] "Question" option1 | option2 | option3
+//	!poll close
+func handlePoll(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	syntax := "Syntax is " + settings.Prefix + "poll [duration] \"Question\" option1 | option2."
+
+	if len(args) == 0 {
+		poll, err := service.CurrentPoll(ctx, channel)
+		if err != nil {
+			respond(channel, user, settings, "There hasn't been a poll yet.")
+			return
+		}
+		respond(channel, user, settings, formatPoll(poll))
+		return
+	}
+
+	if !isMod(user) {
+		return
+	}
+
+	if args[0] == "close" {
+		poll, err := service.CurrentPoll(ctx, channel)
+		if err != nil || !poll.Open {
+			respond(channel, user, settings, "There's no poll running.")
+			return
+		}
+		endPoll(ctx, channel, poll)
+		return
+	}
+
+	poll, ok := parsePoll(strings.Join(args, " "))
+	if !ok {
+		respond(channel, user, settings, syntax)
+		return
+	}
+
+	poll, err := service.NewPoll(ctx, channel, poll)
+	switch err {
+	case nil:
+		trackPoll(channel, poll)
+		publish(channel, "poll_started", poll)
+
+		var options []string
+		for i, option := range poll.Options {
+			options = append(options, fmt.Sprintf("%d) %s", i+1, option))
+		}
+		respond(channel, user, settings, fmt.Sprintf("Poll: %s %s. Vote with %svote <number>!", poll.Question, strings.Join(options, ", "), settings.Prefix))
+	case claudine_bot.ErrAlreadyExist:
+		respond(channel, user, settings, "A poll is already running.")
+	case claudine_bot.ErrInvalidArgument:
+		respond(channel, user, settings, syntax)
+	default:
+		level.Error(logger).Log("msg", "failed to start poll", "channel", channel, "err", err)
+		respond(channel, user, settings, "Error starting the poll.")
+	}
+}
+
+// handleVote votes in the open poll. Voting again changes the vote:
+//
+//	!vote 2
+func handleVote(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	option, err := strconv.Atoi(args[0])
+	if err != nil {
+		return
+	}
+
+	// Votes are silent so a busy poll doesn't flood chat
+	poll, err := service.VotePoll(ctx, channel, strconv.FormatInt(user.UserID, 10), option-1)
+	switch err {
+	case nil:
+		publish(channel, "poll_vote", poll)
+	case claudine_bot.ErrNotFound, claudine_bot.ErrInvalidArgument:
+	default:
+		level.Error(logger).Log("msg", "failed to vote", "channel", channel, "err", err)
+	}
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleQuote handles the quote command:
+//
+//	!quote
+//	!quote 42
+//	!quote search <text>
+func handleQuote(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	var quotes []claudine_bot.Quote
+	var err error
+
+	switch {
+	case len(args) == 0:
+		quotes, err = service.ListQuote(ctx, channel)
+	case args[0] == "search" && len(args) > 1:
+		quotes, err = service.SearchQuote(ctx, channel, strings.Join(args[1:], " "))
+	default:
+		id, convErr := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+		if convErr != nil {
+			respond(channel, user, settings, "Syntax is "+settings.Prefix+"quote [number|search <text>].")
+			return
+		}
+		var quote claudine_bot.Quote
+		quote, err = service.GetQuote(ctx, channel, id)
+		quotes = []claudine_bot.Quote{quote}
+	}
+
+	if err != nil && err != claudine_bot.ErrNotFound {
+		level.Error(logger).Log("msg", "failed to get quotes", "channel", channel, "err", err)
+	}
+	if err != nil || len(quotes) == 0 {
+		respond(channel, user, settings, "No quotes found.")
+		return
+	}
+
+	respond(channel, user, settings, formatQuote(quotes[rand.Intn(len(quotes))], settings))
+}
+
+// handleAddQuote saves a quote along with the game being played. Mods only.
+func handleAddQuote(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	if len(args) == 0 {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"addquote <text>.")
+		return
+	}
+
+	game, err := currentGame(channel)
+	if err != nil {
+		// The quote is still worth saving without the game
+		level.Warn(logger).Log("msg", "failed to get game", "channel", channel, "err", err)
+	}
+
+	quote, err := service.NewQuote(ctx, channel, claudine_bot.Quote{
+		Text:     strings.Join(args, " "),
+		QuotedBy: user.Username,
+		Game:     game,
+	})
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to add quote", "channel", channel, "err", err)
+		respond(channel, user, settings, "Error adding the quote.")
+		return
+	}
+
+	respond(channel, user, settings, fmt.Sprintf("Quote #%d added.", quote.ID))
+}
+
+// handleDelQuote deletes a quote by number. Mods only.
+func handleDelQuote(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+
+	var id int
+	var err error
+	if len(args) > 0 {
+		id, err = strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	}
+	if len(args) == 0 || err != nil {
+		respond(channel, user, settings, "Syntax is "+settings.Prefix+"delquote <number>.")
+		return
+	}
+
+	if err := service.DeleteQuote(ctx, channel, id); err != nil {
+		respond(channel, user, settings, fmt.Sprintf("Quote #%d doesn't exist.", id))
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("Quote #%d deleted.", id))
+}
+
+// formatQuote renders a quote with its date in the channel's timezone.
+func formatQuote(quote claudine_bot.Quote, settings claudine_bot.ChannelSettings) string {
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	text := fmt.Sprintf("#%d: %s", quote.ID, quote.Text)
+	if quote.Game != "" {
+		text += " [" + quote.Game + "]"
+	}
+	return text + " (" + quote.CreatedAt.In(location).Format("Jan 2, 2006") + ")"
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the open raffle is cached, so chat messages don't each hit the service.
+const raffleTTL = 10 * time.Second
+
+type cachedRaffle struct {
+	raffle  claudine_bot.Raffle
+	expires time.Time
+}
+
+var (
+	raffleMtx   sync.Mutex
+	raffleCache = make(map[string]cachedRaffle)
+)
+
+// openRaffle returns the channel's raffle if one is taking entries.
+func openRaffle(channel string) (claudine_bot.Raffle, bool) {
+	raffleMtx.Lock()
+	defer raffleMtx.Unlock()
+
+	cached, ok := raffleCache[channel]
+	if !ok || time.Now().After(cached.expires) {
+		raffle, err := service.CurrentRaffle(context.Background(), channel)
+		if err != nil && err != claudine_bot.ErrNotFound {
+			level.Error(logger).Log("msg", "failed to get raffle", "channel", channel, "err", err)
+		}
+		cached = cachedRaffle{raffle: raffle, expires: time.Now().Add(raffleTTL)}
+		raffleCache[channel] = cached
+	}
+	return cached.raffle, cached.raffle.Open
+}
+
+// forgetRaffle drops the cached raffle after a mod changes it.
+func forgetRaffle(channel string) {
+	raffleMtx.Lock()
+	defer raffleMtx.Unlock()
+
+	delete(raffleCache, channel)
+}
+
+// enterRaffle enters the user if the message is the open raffle's keyword.
+// Entries are silent so a busy raffle doesn't flood chat.
+func enterRaffle(ctx context.Context, channel string, user twitch.User, text string) bool {
+	raffle, ok := openRaffle(channel)
+	if !ok || !strings.EqualFold(strings.TrimSpace(text), raffle.Keyword) {
+		return false
+	}
+
+	_, subscriber := user.Badges["subscriber"]
+	_, err := service.EnterRaffle(ctx, channel, user.Username, subscriber)
+	switch err {
+	case nil, claudine_bot.ErrAlreadyExist, claudine_bot.ErrInsufficientPoints:
+	case claudine_bot.ErrNotFound:
+		forgetRaffle(channel)
+	default:
+		level.Error(logger).Log("msg", "failed to enter raffle", "channel", channel, "user", user.Username, "err", err)
+	}
+	return true
+}
+
+// handleRaffle handles the raffle command. Anyone can see the raffle, mods run
+// it:
+//
+//	!raffle
+//	!raffle open <keyword> [cost] [sub entries]
+//	!raffle close
+//	!raffle draw [winners]
+func handleRaffle(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	syntax := "Syntax is " + settings.Prefix + "raffle [open <keyword> [cost] [sub entries]|close|draw [winners]]."
+
+	if len(args) == 0 {
+		raffle, ok := openRaffle(channel)
+		if !ok {
+			respond(channel, user, settings, "There's no raffle running.")
+			return
+		}
+		text := fmt.Sprintf("Type %s to enter the raffle! %d entered so far.", raffle.Keyword, len(raffle.Entrants))
+		if raffle.Cost > 0 {
+			text += fmt.Sprintf(" Entry costs %d points.", raffle.Cost)
+		}
+		respond(channel, user, settings, text)
+		return
+	}
+
+	if !isMod(user) {
+		return
+	}
+	defer forgetRaffle(channel)
+
+	switch args[0] {
+	case "open":
+		if len(args) < 2 {
+			respond(channel, user, settings, "Not enough args. "+syntax)
+			return
+		}
+		raffle := claudine_bot.Raffle{Keyword: args[1]}
+		var costErr, weightErr error
+		if len(args) > 2 {
+			raffle.Cost, costErr = strconv.Atoi(args[2])
+		}
+		if len(args) > 3 {
+			raffle.SubWeight, weightErr = strconv.Atoi(args[3])
+		}
+		if costErr != nil || weightErr != nil {
+			respond(channel, user, settings, syntax)
+			return
+		}
+
+		raffle, err := service.OpenRaffle(ctx, channel, raffle)
+		switch err {
+		case nil:
+			respond(channel, user, settings, "Raffle open! Type "+raffle.Keyword+" to enter.")
+		case claudine_bot.ErrAlreadyExist:
+			respond(channel, user, settings, "A raffle is already running.")
+		case claudine_bot.ErrInvalidArgument:
+			respond(channel, user, settings, syntax)
+		default:
+			level.Error(logger).Log("msg", "failed to open raffle", "channel", channel, "err", err)
+			respond(channel, user, settings, "Error opening the raffle.")
+		}
+
+	case "close":
+		raffle, err := service.CurrentRaffle(ctx, channel)
+		if err != nil || !raffle.Open {
+			respond(channel, user, settings, "There's no raffle running.")
+			return
+		}
+		raffle, err = service.CloseRaffle(ctx, channel, raffle.ID)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to close raffle", "channel", channel, "err", err)
+			respond(channel, user, settings, "Error closing the raffle.")
+			return
+		}
+		respond(channel, user, settings, fmt.Sprintf("Raffle closed with %d entered.", len(raffle.Entrants)))
+
+	case "draw":
+		count := 1
+		if len(args) > 1 {
+			var err error
+			count, err = strconv.Atoi(args[1])
+			if err != nil || count < 1 {
+				respond(channel, user, settings, syntax)
+				return
+			}
+		}
+
+		raffle, err := service.CurrentRaffle(ctx, channel)
+		if err != nil {
+			respond(channel, user, settings, "There's no raffle to draw.")
+			return
+		}
+		raffle, err = service.DrawRaffle(ctx, channel, raffle.ID, count, 0)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to draw raffle", "channel", channel, "err", err)
+			respond(channel, user, settings, "Error drawing the raffle.")
+			return
+		}
+
+		draw := raffle.Draws[len(raffle.Draws)-1]
+		level.Info(logger).Log("msg", "raffle drawn", "channel", channel, "raffle", raffle.ID, "seed", draw.Seed, "entrants", len(raffle.Entrants), "winners", strings.Join(draw.Winners, ","))
+		if len(draw.Winners) == 0 {
+			respond(channel, user, settings, "Nobody is left to win.")
+			return
+		}
+		respond(channel, user, settings, fmt.Sprintf("Congratulations %s! (seed %d)", strings.Join(draw.Winners, ", "), draw.Seed))
+
+	default:
+		respond(channel, user, settings, syntax)
+	}
+}
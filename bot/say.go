@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"context"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strings"
+	"unicode/utf8"
+)
+
+// Longest message Twitch accepts, in characters.
+const maxMessageLength = 500
+
+// Say queues a message for a channel on behalf of another service, rendering
+// it like a command first if render is set. It is a claudine_bot.SayFunc.
+func Say(ctx context.Context, channel string, message string, render bool) (string, error) {
+	if c := connectionFor(channel); c == nil || !c.isConnected() {
+		return "", claudine_bot.ErrNotConnected
+	}
+
+	if render {
+		command := claudine_bot.Command{Trigger: "say", Action: message}
+		text, err := GetCommandString(channel, command, twitch.User{})
+		if err != nil {
+			return "", claudine_bot.ErrInvalidArgument
+		}
+		message = text
+	}
+
+	message = strings.TrimSpace(message)
+	if message == "" || utf8.RuneCountInString(message) > maxMessageLength {
+		return "", claudine_bot.ErrInvalidArgument
+	}
+
+	level.Info(logger).Log("msg", "saying message from the API", "channel", channel)
+	say(channel, message, priorityNormal)
+	return message, nil
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"context"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/rcole5/claudine-bot"
+	"sync"
+	"time"
+)
+
+// How long channel settings are cached before being read from the service again.
+const settingsTTL = 30 * time.Second
+
+type cachedSettings struct {
+	settings claudine_bot.ChannelSettings
+	expires  time.Time
+}
+
+var (
+	settingsMtx   sync.Mutex
+	settingsCache = make(map[string]cachedSettings)
+
+	cooldownMtx sync.Mutex
+	lastUsed    = make(map[string]time.Time)
+)
+
+// getSettings returns the settings for a channel, falling back to the defaults
+// if they can't be loaded.
+func getSettings(channel string) claudine_bot.ChannelSettings {
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+
+	cached, ok := settingsCache[channel]
+	if ok && time.Now().Before(cached.expires) {
+		return cached.settings
+	}
+
+	settings, err := service.GetSettings(context.Background(), channel)
+	if err != nil {
+		settings = claudine_bot.DefaultSettings
+	}
+
+	settingsCache[channel] = cachedSettings{
+		settings: settings,
+		expires:  time.Now().Add(settingsTTL),
+	}
+	return settings
+}
+
+// onCooldown reports whether a command is still cooling down for the channel or
+// user. If it isn't, the command is marked as used.
+func onCooldown(channel string, trigger string, user twitch.User, settings claudine_bot.ChannelSettings) bool {
+	cooldownMtx.Lock()
+	defer cooldownMtx.Unlock()
+
+	now := time.Now()
+	globalKey := channel + "/" + trigger
+	userKey := globalKey + "/" + user.Username
+
+	global := time.Duration(settings.GlobalCooldown) * time.Second
+	if last, ok := lastUsed[globalKey]; ok && now.Sub(last) < global {
+		return true
+	}
+
+	perUser := time.Duration(settings.UserCooldown) * time.Second
+	if last, ok := lastUsed[userKey]; ok && now.Sub(last) < perUser {
+		return true
+	}
+
+	lastUsed[globalKey] = now
+	lastUsed[userKey] = now
+	return false
+}
+
+// respond sends a response to a user according to the channel's response mode.
+func respond(channel string, user twitch.User, settings claudine_bot.ChannelSettings, text string) {
+	if settings.ResponseMode == claudine_bot.ResponseModeReply && user.Username != "" {
+		text = "@" + user.DisplayName + " " + text
+	}
+	say(channel, text, priorityNormal)
+}
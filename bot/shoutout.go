@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// How long a channel lookup is reused for.
+const shoutoutCacheTTL = 10 * time.Minute
+
+// ShoutoutVariables are the variables available to the shoutout template.
+type ShoutoutVariables struct {
+	User        string
+	DisplayName string
+	Game        string
+	URL         string
+}
+
+type channelInfo struct {
+	name    string
+	game    string
+	fetched time.Time
+}
+
+var (
+	shoutoutMtx sync.Mutex
+	// channelCache holds looked up channels by login. Unknown users are
+	// cached with an empty name.
+	channelCache = make(map[string]channelInfo)
+	// lastShoutout holds when each channel/user was last shouted out.
+	lastShoutout = make(map[string]time.Time)
+)
+
+// lookupChannel returns a channel's display name and last game, cached for a
+// while. The name is empty if there is no such channel.
+func lookupChannel(login string) (string, string, error) {
+	login = strings.ToLower(login)
+
+	shoutoutMtx.Lock()
+	info, ok := channelCache[login]
+	shoutoutMtx.Unlock()
+	if ok && time.Since(info.fetched) < shoutoutCacheTTL {
+		return info.name, info.game, nil
+	}
+
+	name, game, err := lastGame(login)
+	if err != nil {
+		return "", "", err
+	}
+
+	shoutoutMtx.Lock()
+	channelCache[login] = channelInfo{name: name, game: game, fetched: time.Now()}
+	shoutoutMtx.Unlock()
+	return name, game, nil
+}
+
+// shoutoutCooling reports whether the target was shouted out too recently,
+// and otherwise starts its cooldown.
+func shoutoutCooling(channel string, target string, cooldown int) bool {
+	shoutoutMtx.Lock()
+	defer shoutoutMtx.Unlock()
+
+	key := channel + "/" + target
+	if time.Since(lastShoutout[key]) < time.Duration(cooldown)*time.Second {
+		return true
+	}
+	lastShoutout[key] = time.Now()
+	return false
+}
+
+// shoutoutString renders the channel's shoutout template for the target.
+func shoutoutString(channel string, user twitch.User, settings claudine_bot.ChannelSettings, vars ShoutoutVariables) (string, error) {
+	t, err := template.New("Shoutout").Funcs(commandFuncs(channel, user)).Parse(settings.ShoutoutTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// shoutout posts a shoutout for the target unless it is cooling down. It
+// reports false if there is no such channel.
+func shoutout(channel string, user twitch.User, settings claudine_bot.ChannelSettings, target string) (bool, error) {
+	target = strings.ToLower(strings.TrimPrefix(target, "@"))
+
+	name, game, err := lookupChannel(target)
+	if err != nil {
+		return false, err
+	}
+	if name == "" {
+		return false, nil
+	}
+
+	if shoutoutCooling(channel, target, settings.ShoutoutCooldown) {
+		return true, nil
+	}
+
+	text, err := shoutoutString(channel, user, settings, ShoutoutVariables{
+		User:        target,
+		DisplayName: name,
+		Game:        game,
+		URL:         "https://twitch.tv/" + target,
+	})
+	if err != nil {
+		return true, err
+	}
+	say(channel, text, priorityNormal)
+	return true, nil
+}
+
+// handleShoutout points chat at another channel. Mods only:
+//
+//	!so someone
+func handleShoutout(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	if len(args) == 0 {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"so <user>.")
+		return
+	}
+
+	found, err := shoutout(channel, user, settings, args[0])
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to shout out", "channel", channel, "target", args[0], "err", err)
+		respond(channel, user, settings, "Error shouting out "+args[0]+".")
+		return
+	}
+	if !found {
+		respond(channel, user, settings, "Couldn't find a channel called "+strings.TrimPrefix(args[0], "@")+".")
+	}
+}
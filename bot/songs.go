@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strings"
+)
+
+// SongResolver fills in song titles and lengths when set. Without one songs are
+// queued straight from the parsed link.
+var SongResolver claudine_bot.SongResolver
+
+// How many upcoming songs !queue lists.
+const queuePreview = 3
+
+// songName is how a song is shown in chat.
+func songName(song claudine_bot.Song) string {
+	if song.Title != "" {
+		return song.Title
+	}
+	return song.URL
+}
+
+// handleSongRequest adds a song to the queue:
+//
+//	!sr https://youtu.be/dQw4w9WgXcQ
+//	!sr artist - song name
+func handleSongRequest(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	song, err := claudine_bot.ParseSong(strings.Join(args, " "))
+	switch err {
+	case nil:
+	case claudine_bot.ErrInvalidArgument:
+		respond(channel, user, settings, "Syntax is "+settings.Prefix+"sr <link or song name>.")
+		return
+	default:
+		respond(channel, user, settings, "Only YouTube, Spotify and SoundCloud links can be requested.")
+		return
+	}
+
+	if SongResolver != nil {
+		resolved, err := SongResolver.Resolve(ctx, song)
+		if err != nil {
+			level.Warn(logger).Log("msg", "failed to resolve song", "channel", channel, "song", songName(song), "err", err)
+		} else {
+			song = resolved
+		}
+	}
+
+	song.RequestedBy = user.Username
+	song, err = service.RequestSong(ctx, channel, song)
+	switch err {
+	case nil:
+		publish(channel, "song_requested", song)
+		respond(channel, user, settings, "Added "+songName(song)+" to the queue.")
+	case claudine_bot.ErrSongBlocked:
+		respond(channel, user, settings, "That song can't be requested.")
+	case claudine_bot.ErrSongTooLong:
+		respond(channel, user, settings, fmt.Sprintf("Songs can be at most %d minutes long.", settings.SongRequests.MaxLength/60))
+	case claudine_bot.ErrSongLimit:
+		respond(channel, user, settings, fmt.Sprintf("You can only have %d songs in the queue.", settings.SongRequests.UserLimit))
+	default:
+		level.Error(logger).Log("msg", "failed to request song", "channel", channel, "err", err)
+		respond(channel, user, settings, "Error adding the song.")
+	}
+}
+
+// handleQueue shows the length of the queue and the next few songs.
+func handleQueue(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings) {
+	queue, err := service.ListSong(ctx, channel)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list songs", "channel", channel, "err", err)
+		return
+	}
+	if len(queue) == 0 {
+		respond(channel, user, settings, "The queue is empty.")
+		return
+	}
+
+	var next []string
+	for i, song := range queue {
+		if i == queuePreview {
+			break
+		}
+		next = append(next, songName(song))
+	}
+	respond(channel, user, settings, fmt.Sprintf("%d songs queued. Next up: %s", len(queue), strings.Join(next, ", ")))
+}
+
+// handleSkip moves on to the next song. Mods only.
+func handleSkip(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings) {
+	if !isMod(user) {
+		return
+	}
+
+	song, err := service.NextSong(ctx, channel)
+	switch err {
+	case nil:
+		publish(channel, "song_skipped", song)
+		respond(channel, user, settings, "Skipped. Now playing "+songName(song)+".")
+	case claudine_bot.ErrNotFound:
+		publish(channel, "song_skipped", nil)
+		respond(channel, user, settings, "Skipped. The queue is empty.")
+	default:
+		level.Error(logger).Log("msg", "failed to skip song", "channel", channel, "err", err)
+	}
+}
+
+// handleWrongSong removes the user's latest request from the queue.
+func handleWrongSong(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings) {
+	queue, err := service.ListSong(ctx, channel)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list songs", "channel", channel, "err", err)
+		return
+	}
+
+	for i := len(queue) - 1; i >= 0; i-- {
+		if queue[i].RequestedBy != strings.ToLower(user.Username) {
+			continue
+		}
+		if err := service.DeleteSong(ctx, channel, queue[i].ID); err != nil {
+			level.Error(logger).Log("msg", "failed to delete song", "channel", channel, "err", err)
+			return
+		}
+		publish(channel, "song_removed", queue[i])
+		respond(channel, user, settings, "Removed "+songName(queue[i])+" from the queue.")
+		return
+	}
+	respond(channel, user, settings, "You don't have any songs in the queue.")
+}
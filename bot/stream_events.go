@@ -0,0 +1,280 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/nicklaw5/helix"
+	"github.com/rcole5/claudine-bot"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// EventVariables are the variables available to event response templates.
+type EventVariables struct {
+	User        string
+	DisplayName string
+	Channel     string
+	// Months subscribed in total.
+	Months int
+	// Tier of the sub: Prime, 1, 2 or 3.
+	Tier string
+	// Recipient of a gifted sub.
+	Recipient string
+	// Gifts given at once in a mystery gift.
+	Gifts int
+	// Viewers brought along by a raid.
+	Viewers int
+	Bits    int
+	// Message the user sent with their sub or cheer.
+	Message string
+	Now     time.Time
+}
+
+// How long the gifts of a mystery gift can keep arriving after it.
+const mysteryGiftWindow = 5 * time.Minute
+
+var (
+	followsMtx sync.Mutex
+	// lastFollow holds the time of the newest follow seen for each channel.
+	lastFollow = make(map[string]time.Time)
+	channelIDs = make(map[string]string)
+
+	mysteryGiftsMtx sync.Mutex
+	// mysteryGifts holds when each recent mystery gift was seen, by origin ID.
+	mysteryGifts = make(map[string]time.Time)
+)
+
+// usernoticeEvents maps USERNOTICE msg-ids to the events they trigger.
+var usernoticeEvents = map[string]string{
+	"sub":                claudine_bot.EventSub,
+	"resub":              claudine_bot.EventResub,
+	"subgift":            claudine_bot.EventSubGift,
+	"anonsubgift":        claudine_bot.EventSubGift,
+	"submysterygift":     claudine_bot.EventMysteryGift,
+	"anonsubmysterygift": claudine_bot.EventMysteryGift,
+	"raid":               claudine_bot.EventRaid,
+}
+
+// handleUsernotice responds to subs, gift subs and raids.
+func handleUsernotice(channel string, user twitch.User, message twitch.Message) {
+	event, ok := usernoticeEvents[message.Tags["msg-id"]]
+	if !ok {
+		return
+	}
+
+	tags := message.Tags
+	if partOfMysteryGift(tags) {
+		// The mystery gift already responded for all of its gifts
+		return
+	}
+
+	vars := EventVariables{
+		User:        user.Username,
+		DisplayName: user.DisplayName,
+		Channel:     channel,
+		Tier:        subTier(tags["msg-param-sub-plan"]),
+		Recipient:   tagUnescaper.Replace(tags["msg-param-recipient-display-name"]),
+		Message:     message.Text,
+	}
+	vars.Months, _ = strconv.Atoi(tags["msg-param-cumulative-months"])
+	if vars.Months == 0 {
+		vars.Months, _ = strconv.Atoi(tags["msg-param-months"])
+	}
+	vars.Gifts, _ = strconv.Atoi(tags["msg-param-mass-gift-count"])
+	vars.Viewers, _ = strconv.Atoi(tags["msg-param-viewerCount"])
+
+	streamEvent(channel, user, event, vars)
+
+	if settings := getSettings(channel); event == claudine_bot.EventRaid && settings.RaidShoutout {
+		raidShoutout(channel, user, settings)
+	}
+}
+
+// partOfMysteryGift remembers mystery gifts and reports whether a gifted sub
+// is one of the gifts of a mystery gift, which Twitch announces one by one
+// after it.
+func partOfMysteryGift(tags map[string]string) bool {
+	mysteryGiftsMtx.Lock()
+	defer mysteryGiftsMtx.Unlock()
+
+	now := time.Now()
+	for id, seen := range mysteryGifts {
+		if now.Sub(seen) > mysteryGiftWindow {
+			delete(mysteryGifts, id)
+		}
+	}
+
+	origin := tags["msg-param-origin-id"]
+	switch tags["msg-id"] {
+	case "submysterygift", "anonsubmysterygift":
+		if origin != "" {
+			mysteryGifts[origin] = now
+		}
+	case "subgift", "anonsubgift":
+		if tags["msg-param-community-gift-id"] != "" {
+			return true
+		}
+		_, ok := mysteryGifts[origin]
+		return ok && origin != ""
+	}
+	return false
+}
+
+// handleCheer responds to a message with bits in it.
+func handleCheer(channel string, user twitch.User, message twitch.Message) {
+	bits, err := strconv.Atoi(message.Tags["bits"])
+	if err != nil || bits <= 0 {
+		return
+	}
+
+	streamEvent(channel, user, claudine_bot.EventCheer, EventVariables{
+		User:        user.Username,
+		DisplayName: user.DisplayName,
+		Channel:     channel,
+		Bits:        bits,
+		Message:     message.Text,
+	})
+}
+
+// subTier turns a sub plan into the tier shown in chat.
+func subTier(plan string) string {
+	switch plan {
+	case "Prime":
+		return "Prime"
+	case "2000":
+		return "2"
+	case "3000":
+		return "3"
+	}
+	return "1"
+}
+
+// streamEvent publishes a stream event and posts the channel's response to it,
+// if it has one.
+func streamEvent(channel string, user twitch.User, event string, vars EventVariables) {
+	publish(channel, event, vars)
+
+	r, err := service.GetEventResponse(context.Background(), channel, event)
+	if err != nil || !r.Enabled {
+		return
+	}
+
+	text, err := eventResponseString(channel, user, r, vars)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to render event response", "channel", channel, "event", event, "err", err)
+		return
+	}
+	say(channel, text, priorityNormal)
+}
+
+// eventResponseString renders an event response template.
+func eventResponseString(channel string, user twitch.User, r claudine_bot.EventResponse, vars EventVariables) (string, error) {
+	t, err := template.New("Event Response").Funcs(commandFuncs(channel, user)).Parse(r.Template)
+	if err != nil {
+		return "", err
+	}
+
+	// Times are shown in the channel's timezone
+	location, err := time.LoadLocation(getSettings(channel).Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	vars.Now = time.Now().In(location)
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// raidShoutout points chat at a raider's channel.
+func raidShoutout(channel string, raider twitch.User, settings claudine_bot.ChannelSettings) {
+	if _, err := shoutout(channel, raider, settings, raider.Username); err != nil {
+		level.Error(logger).Log("msg", "failed to shout out raider", "channel", channel, "raider", raider.Username, "err", err)
+	}
+}
+
+// checkFollows looks for new followers of the joined channels that respond to
+// follows. Twitch doesn't send follows over IRC, so they are polled.
+func checkFollows(ctx context.Context) {
+	joinedMtx.Lock()
+	channels := make([]string, 0, len(joined))
+	for channel := range joined {
+		channels = append(channels, channel)
+	}
+	joinedMtx.Unlock()
+
+	for _, channel := range channels {
+		r, err := service.GetEventResponse(ctx, channel, claudine_bot.EventFollow)
+		if err != nil || !r.Enabled {
+			continue
+		}
+
+		if err := checkChannelFollows(channel); err != nil {
+			level.Error(logger).Log("msg", "failed to check follows", "channel", channel, "err", err)
+		}
+	}
+}
+
+// checkChannelFollows posts a follow event for each follower since the last
+// check. The first check only remembers the newest follow.
+func checkChannelFollows(channel string) error {
+	followsMtx.Lock()
+	id, ok := channelIDs[channel]
+	since, seeded := lastFollow[channel]
+	followsMtx.Unlock()
+
+	if !ok {
+		var err error
+		if id, err = userID(channel); err != nil {
+			return err
+		}
+		if id == "" {
+			return claudine_bot.ErrNotFound
+		}
+		followsMtx.Lock()
+		channelIDs[channel] = id
+		followsMtx.Unlock()
+	}
+
+	resp, err := getUsersFollows(&helix.UsersFollowsParams{
+		ToID:  id,
+		First: 20,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Follows are newest first
+	follows := resp.Data.Follows
+	newest := since
+	if len(follows) > 0 {
+		newest = follows[0].FollowedAt
+	}
+	followsMtx.Lock()
+	lastFollow[channel] = newest
+	followsMtx.Unlock()
+	if !seeded {
+		return nil
+	}
+
+	for i := len(follows) - 1; i >= 0; i-- {
+		f := follows[i]
+		if !f.FollowedAt.After(since) {
+			continue
+		}
+		user := twitch.User{Username: strings.ToLower(f.FromName), DisplayName: f.FromName}
+		streamEvent(channel, user, claudine_bot.EventFollow, EventVariables{
+			User:        user.Username,
+			DisplayName: f.FromName,
+			Channel:     channel,
+		})
+	}
+	return nil
+}
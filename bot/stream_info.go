@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/gempir/go-twitch-irc"
+	"github.com/go-kit/kit/log/level"
+	"github.com/rcole5/claudine-bot"
+	"strings"
+	"time"
+)
+
+// handleTitle shows the channel's title.
+func handleTitle(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	title, err := channelTitle(channel)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get title", "channel", channel, "err", err)
+		return
+	}
+	if title == "" {
+		respond(channel, user, settings, channel+" has no title.")
+		return
+	}
+	respond(channel, user, settings, title)
+}
+
+// handleGame shows the game the channel is playing, or played last.
+func handleGame(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	_, game, err := lastGame(channel)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get game", "channel", channel, "err", err)
+		return
+	}
+	if game == "" {
+		respond(channel, user, settings, channel+" isn't playing anything.")
+		return
+	}
+	respond(channel, user, settings, channel+" is playing "+game+".")
+}
+
+// handleViewers shows how many people are watching.
+func handleViewers(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	viewers, live, err := viewerCount(channel)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get stream", "channel", channel, "err", err)
+		return
+	}
+	if !live {
+		respond(channel, user, settings, "User is not live")
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("%d viewers are watching %s.", viewers, channel))
+}
+
+// handleFollowage shows how long someone has followed the channel:
+//
+//	!followage [user]
+func handleFollowage(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	target := user.Username
+	if len(args) > 0 {
+		target = strings.ToLower(strings.TrimPrefix(args[0], "@"))
+	}
+
+	since, ok, err := followedAt(target, channel)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get follow", "channel", channel, "user", target, "err", err)
+		return
+	}
+	if !ok {
+		respond(channel, user, settings, target+" isn't following "+channel+".")
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("%s has been following %s for %s.", target, channel, fmtAge(since, time.Now())))
+}
+
+// handleAccountage shows how old someone's account is:
+//
+//	!accountage [user]
+func handleAccountage(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	target := user.Username
+	if len(args) > 0 {
+		target = strings.ToLower(strings.TrimPrefix(args[0], "@"))
+	}
+
+	created, ok, err := accountCreated(target)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get user", "channel", channel, "user", target, "err", err)
+		return
+	}
+	if !ok {
+		respond(channel, user, settings, "There is no user called "+target+".")
+		return
+	}
+	respond(channel, user, settings, fmt.Sprintf("%s's account is %s old.", target, fmtAge(created, time.Now())))
+}
+
+// handleSetTitle changes the channel's title. Mods only:
+//
+//	!settitle a new title
+func handleSetTitle(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	title := strings.Join(args, " ")
+	if title == "" {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"settitle <title>.")
+		return
+	}
+
+	if !updateChannel(ctx, channel, user, settings, channelUpdate{Title: title}) {
+		return
+	}
+	respond(channel, user, settings, "Title changed to "+title)
+}
+
+// handleSetGame changes the channel's game. Mods only:
+//
+//	!setgame Some Game
+func handleSetGame(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, args []string) {
+	if !isMod(user) {
+		return
+	}
+	name := strings.Join(args, " ")
+	if name == "" {
+		respond(channel, user, settings, "Not enough args. Syntax is "+settings.Prefix+"setgame <game>.")
+		return
+	}
+
+	id, err := gameID(name)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get game", "channel", channel, "game", name, "err", err)
+		respond(channel, user, settings, "Error changing the game.")
+		return
+	}
+	if id == "" {
+		respond(channel, user, settings, "Couldn't find a game called "+name+".")
+		return
+	}
+
+	if !updateChannel(ctx, channel, user, settings, channelUpdate{GameID: id}) {
+		return
+	}
+	respond(channel, user, settings, "Game changed to "+name)
+}
+
+// updateChannel edits the channel with its broadcaster token, telling chat if
+// it can't.
+func updateChannel(ctx context.Context, channel string, user twitch.User, settings claudine_bot.ChannelSettings, update channelUpdate) bool {
+	token, err := service.GetBroadcasterToken(ctx, channel)
+	if err == claudine_bot.ErrNotFound {
+		respond(channel, user, settings, "The broadcaster hasn't let me edit the channel.")
+		return false
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get broadcaster token", "channel", channel, "err", err)
+		respond(channel, user, settings, "Error changing the channel.")
+		return false
+	}
+
+	id, err := userID(channel)
+	if err == nil && id == "" {
+		err = claudine_bot.ErrNotFound
+	}
+	if err == nil {
+		err = modifyChannel(id, token, update)
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to modify channel", "channel", channel, "err", err)
+		respond(channel, user, settings, "Error changing the channel.")
+		return false
+	}
+	return true
+}
+
+// channelTitle returns the channel's title, live or not.
+func channelTitle(channel string) (string, error) {
+	c, _, err := searchChannel(channel)
+	return c.Title, err
+}
+
+// viewerCount returns how many people are watching the channel, and whether it
+// is live.
+func viewerCount(channel string) (int, bool, error) {
+	stream, live, err := streamInfo(channel)
+	return stream.ViewerCount, live, err
+}
+
+// fmtAge describes the time between since and now in years, months and days.
+func fmtAge(since time.Time, now time.Time) string {
+	since = since.In(now.Location())
+	years := now.Year() - since.Year()
+	months := int(now.Month()) - int(since.Month())
+	days := now.Day() - since.Day()
+	if days < 0 {
+		months--
+		// Borrow the length of the month before now, but at least since's day
+		// so the end of a long month doesn't go negative
+		borrow := time.Date(now.Year(), now.Month(), 0, 0, 0, 0, 0, now.Location()).Day()
+		if since.Day() > borrow {
+			borrow = since.Day()
+		}
+		days += borrow
+	}
+	if months < 0 {
+		years--
+		months += 12
+	}
+
+	var parts []string
+	for _, p := range []struct {
+		n    int
+		unit string
+	}{{years, "year"}, {months, "month"}, {days, "day"}} {
+		if p.n == 1 {
+			parts = append(parts, "1 "+p.unit)
+		} else if p.n > 1 {
+			parts = append(parts, fmt.Sprintf("%d %ss", p.n, p.unit))
+		}
+	}
+	if len(parts) == 0 {
+		return "less than a day"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// The stream info template functions show nothing when Twitch can't be reached.
+
+func titleFunc(channel string) func() string {
+	return func() string {
+		title, _ := channelTitle(channel)
+		return title
+	}
+}
+
+func gameFunc(channel string) func() string {
+	return func() string {
+		_, game, _ := lastGame(channel)
+		return game
+	}
+}
+
+func viewersFunc(channel string) func() int {
+	return func() int {
+		viewers, _, _ := viewerCount(channel)
+		return viewers
+	}
+}
+
+func followageFunc(channel string, user twitch.User) func() string {
+	return func() string {
+		if user.Username == "" {
+			return ""
+		}
+		since, ok, err := followedAt(user.Username, channel)
+		if err != nil || !ok {
+			return ""
+		}
+		return fmtAge(since, time.Now())
+	}
+}
+
+func accountageFunc(user twitch.User) func() string {
+	return func() string {
+		if user.Username == "" {
+			return ""
+		}
+		created, ok, err := accountCreated(user.Username)
+		if err != nil || !ok {
+			return ""
+		}
+		return fmtAge(created, time.Now())
+	}
+}
@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log/level"
+	"github.com/nicklaw5/helix"
+	"github.com/rcole5/claudine-bot"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How often every channel's stream is checked.
+	streamPollInterval = 30 * time.Second
+	// How old a cached stream can be before it is looked up again.
+	streamStatusTTL = 2 * time.Minute
+	// Most logins or IDs Helix takes in one GetUsers or GetStreams call.
+	streamsBatchSize = 100
+)
+
+var ErrHelixRateLimited = errors.New("helix rate limit reached")
+
+type streamStatus struct {
+	live    bool
+	stream  helix.Stream
+	checked time.Time
+}
+
+var (
+	streamsMtx     sync.RWMutex
+	streamStatuses = make(map[string]streamStatus)
+
+	userIDsMtx sync.RWMutex
+	// userIDs caches the Twitch user ID of each channel's login, since streams
+	// are matched by ID rather than by display name.
+	userIDs = make(map[string]string)
+
+	rateLimitMtx sync.Mutex
+	// helixPausedUntil is when Helix can be called again after running out of
+	// requests.
+	helixPausedUntil time.Time
+)
+
+// pollStreams refreshes the stream status of every channel, in as few calls
+// as it can.
+func pollStreams(ctx context.Context) {
+	channels, err := service.ListChannel(ctx)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to list channels", "err", err)
+		return
+	}
+
+	logins := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		logins = append(logins, strings.ToLower(string(channel)))
+	}
+
+	for len(logins) > 0 {
+		n := len(logins)
+		if n > streamsBatchSize {
+			n = streamsBatchSize
+		}
+		batch := logins[:n]
+		logins = logins[n:]
+
+		err := fetchStreams(batch)
+		if err == ErrHelixRateLimited {
+			// The rest would be refused too, they're polled next time
+			level.Warn(logger).Log("msg", "stopped polling streams", "err", err)
+			return
+		}
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to poll streams", "err", err)
+		}
+	}
+}
+
+// channelUserIDs returns the user IDs of the logins, looking up the ones that
+// aren't cached. Logins without a Twitch user are left out.
+func channelUserIDs(logins []string) (map[string]string, error) {
+	ids := make(map[string]string, len(logins))
+	var missing []string
+	userIDsMtx.RLock()
+	for _, login := range logins {
+		if id, ok := userIDs[login]; ok {
+			ids[login] = id
+		} else {
+			missing = append(missing, login)
+		}
+	}
+	userIDsMtx.RUnlock()
+	if len(missing) == 0 {
+		return ids, nil
+	}
+
+	resp, err := getUsers(&helix.UsersParams{
+		Logins: missing,
+	})
+	if err != nil {
+		return nil, err
+	}
+	noteRateLimit(resp.ResponseCommon)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, ErrHelixRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("helix returned %d: %s", resp.StatusCode, resp.ErrorMessage)
+	}
+
+	userIDsMtx.Lock()
+	for _, user := range resp.Data.Users {
+		login := strings.ToLower(user.Login)
+		userIDs[login] = user.ID
+		ids[login] = user.ID
+	}
+	userIDsMtx.Unlock()
+	return ids, nil
+}
+
+// fetchStreams looks up the streams of up to 100 channels and caches them.
+func fetchStreams(logins []string) error {
+	if helixPaused() {
+		return ErrHelixRateLimited
+	}
+
+	ids, err := channelUserIDs(logins)
+	if err != nil {
+		return err
+	}
+
+	// Display names can differ from logins, so streams are matched by user ID
+	live := make(map[string]helix.Stream)
+	if len(ids) > 0 {
+		params := &helix.StreamsParams{
+			First: streamsBatchSize,
+		}
+		for _, id := range ids {
+			params.UserIDs = append(params.UserIDs, id)
+		}
+
+		resp, err := getStreams(params)
+		if err != nil {
+			return err
+		}
+		noteRateLimit(resp.ResponseCommon)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return ErrHelixRateLimited
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("helix returned %d: %s", resp.StatusCode, resp.ErrorMessage)
+		}
+
+		for _, stream := range resp.Data.Streams {
+			live[stream.UserID] = stream
+		}
+	}
+
+	now := time.Now()
+	for _, login := range logins {
+		stream, ok := live[ids[login]]
+		setStreamStatus(login, streamStatus{live: ok, stream: stream, checked: now})
+	}
+	return nil
+}
+
+// setStreamStatus caches a channel's stream, announcing when it goes live or
+// offline.
+func setStreamStatus(channel string, status streamStatus) {
+	streamsMtx.Lock()
+	previous, known := streamStatuses[channel]
+	streamStatuses[channel] = status
+	streamsMtx.Unlock()
+
+	if !known || previous.live == status.live {
+		return
+	}
+	if status.live {
+		level.Info(logger).Log("msg", "channel went live", "channel", channel)
+		publish(channel, claudine_bot.EventStreamOnline, status.stream)
+		notifyWebhooks(channel, claudine_bot.EventStreamOnline, status.stream)
+	} else {
+		level.Info(logger).Log("msg", "channel went offline", "channel", channel)
+		publish(channel, claudine_bot.EventStreamOffline, previous.stream)
+		notifyWebhooks(channel, claudine_bot.EventStreamOffline, previous.stream)
+	}
+}
+
+// notifyWebhooks tells the channel's webhooks that it went live or offline.
+func notifyWebhooks(channel string, event string, stream helix.Stream) {
+	if Webhooks == nil {
+		return
+	}
+
+	vars := claudine_bot.WebhookVariables{
+		Event:     event,
+		Channel:   channel,
+		URL:       "https://twitch.tv/" + channel,
+		Title:     stream.Title,
+		Viewers:   stream.ViewerCount,
+		StartedAt: stream.StartedAt,
+		Time:      time.Now().UTC(),
+	}
+	if stream.GameID != "" {
+		vars.Game, _ = gameName(stream.GameID)
+	}
+
+	if event == claudine_bot.EventStreamOnline {
+		vars.Message = fmt.Sprintf("%s is live: %s %s", channel, stream.Title, vars.URL)
+	} else {
+		vars.Message = channel + " has gone offline."
+	}
+	Webhooks.Notify(channel, vars)
+}
+
+// streamInfo returns the channel's stream and whether it is live, from the
+// cache when it is fresh enough. A stale status is used while Helix is rate
+// limited.
+func streamInfo(channel string) (helix.Stream, bool, error) {
+	channel = strings.ToLower(channel)
+
+	streamsMtx.RLock()
+	status, ok := streamStatuses[channel]
+	streamsMtx.RUnlock()
+	if ok && time.Since(status.checked) < streamStatusTTL {
+		return status.stream, status.live, nil
+	}
+
+	if err := fetchStreams([]string{channel}); err != nil {
+		if ok {
+			return status.stream, status.live, nil
+		}
+		return helix.Stream{}, false, err
+	}
+
+	streamsMtx.RLock()
+	status = streamStatuses[channel]
+	streamsMtx.RUnlock()
+	return status.stream, status.live, nil
+}
+
+// noteRateLimit pauses Helix calls until the rate limit resets once there are
+// no requests left.
+func noteRateLimit(resp helix.ResponseCommon) {
+	if resp.Header == nil || resp.Header.Get("RateLimit-Remaining") == "" {
+		return
+	}
+	if resp.GetRateLimitRemaining() > 0 && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	reset := time.Unix(int64(resp.GetRateLimitReset()), 0)
+	rateLimitMtx.Lock()
+	helixPausedUntil = reset
+	rateLimitMtx.Unlock()
+	level.Warn(logger).Log("msg", "helix rate limit reached", "reset", reset)
+}
+
+func helixPaused() bool {
+	rateLimitMtx.Lock()
+	defer rateLimitMtx.Unlock()
+
+	return time.Now().Before(helixPausedUntil)
+}
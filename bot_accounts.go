@@ -0,0 +1,180 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var botAccountsBucket = []byte("bot_accounts")
+
+// BotAccount is a Twitch account the bot can chat as. Channels pick one in
+// their settings, and use the default account otherwise.
+type BotAccount struct {
+	Name string `json:"name"`
+	// Token is the account's chat OAuth token. It is never shown by the API.
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// botAccountName is how account names are stored, lowercase like logins.
+func botAccountName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// SetBotAccount adds an account or replaces its token.
+func (s *claudineService) SetBotAccount(ctx context.Context, a BotAccount) (BotAccount, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a.Name = botAccountName(a.Name)
+	a.Token = strings.TrimPrefix(strings.TrimSpace(a.Token), "oauth:")
+	if a.Name == "" || strings.ContainsAny(a.Name, " \t#") || a.Token == "" {
+		return BotAccount{}, ErrInvalidArgument
+	}
+
+	err := s.store.Update(func(tx Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(botAccountsBucket)
+		if err != nil {
+			return err
+		}
+
+		var existing BotAccount
+		switch err := getJSON(bucket, []byte(a.Name), &existing); err {
+		case nil:
+			a.CreatedAt = existing.CreatedAt
+		case ErrNotFound:
+			a.CreatedAt = time.Now().UTC()
+		default:
+			return err
+		}
+
+		return putJSON(bucket, []byte(a.Name), a)
+	})
+	if err != nil {
+		return BotAccount{}, err
+	}
+
+	return a, nil
+}
+
+func (s *claudineService) GetBotAccount(ctx context.Context, name string) (BotAccount, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var a BotAccount
+	err := s.store.View(func(tx Tx) error {
+		bucket := tx.Bucket(botAccountsBucket)
+		if bucket == nil {
+			return ErrNotFound
+		}
+		return getJSON(bucket, []byte(botAccountName(name)), &a)
+	})
+	if err != nil {
+		return BotAccount{}, err
+	}
+
+	return a, nil
+}
+
+func (s *claudineService) ListBotAccount(ctx context.Context) ([]BotAccount, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []BotAccount
+	err := s.store.View(func(tx Tx) error {
+		bucket := tx.Bucket(botAccountsBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(name, raw []byte) error {
+			var a BotAccount
+			if err := json.Unmarshal(raw, &a); err != nil {
+				return err
+			}
+			list = append(list, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return []BotAccount{}, err
+	}
+
+	return list, nil
+}
+
+// DeleteBotAccount removes an account. Channels that chose it go back to the
+// default account.
+func (s *claudineService) DeleteBotAccount(ctx context.Context, name string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket(botAccountsBucket)
+		if bucket == nil || bucket.Get([]byte(botAccountName(name))) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(botAccountName(name)))
+	})
+}
+
+// MakeBotAccountHandler lists (GET), saves (PUT) or removes (DELETE) the
+// accounts the bot can chat as. Tokens are never read back. Requests must
+// carry the admin token:
+//
+//	GET    /api/v1/admin/bot-accounts
+//	PUT    /api/v1/admin/bot-accounts?name=account {"token": "..."}
+//	DELETE /api/v1/admin/bot-accounts?name=account
+func MakeBotAccountHandler(s Service, adminToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, adminToken) {
+			encodeError(r.Context(), ErrUnauthorized, w)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		switch r.Method {
+		case http.MethodGet:
+			accounts, err := s.ListBotAccount(r.Context())
+			if err != nil {
+				encodeError(r.Context(), err, w)
+				return
+			}
+			for i := range accounts {
+				accounts[i].Token = ""
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(map[string]interface{}{"accounts": accounts})
+
+		case http.MethodPut:
+			var body struct {
+				Token string `json:"token"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				encodeError(r.Context(), ErrInvalidArgument, w)
+				return
+			}
+			a, err := s.SetBotAccount(r.Context(), BotAccount{Name: name, Token: body.Token})
+			if err != nil {
+				encodeError(r.Context(), err, w)
+				return
+			}
+			a.Token = ""
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(map[string]interface{}{"account": a})
+
+		case http.MethodDelete:
+			if err := s.DeleteBotAccount(r.Context(), name); err != nil {
+				encodeError(r.Context(), err, w)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+var broadcasterTokenKey = []byte("broadcaster_token")
+
+// SetBroadcasterToken saves the OAuth token the bot uses to edit the channel on
+// the broadcaster's behalf. An empty token removes it.
+func (s *claudineService) SetBroadcasterToken(ctx context.Context, channel string, token string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	token = strings.TrimPrefix(strings.TrimSpace(token), "oauth:")
+	return s.store.Update(func(tx Tx) error {
+		bucket, err := GetActiveChannelBucket(tx, channel)
+		if err != nil {
+			return err
+		}
+
+		if token == "" {
+			return bucket.Delete(broadcasterTokenKey)
+		}
+		return bucket.Put(broadcasterTokenKey, []byte(token))
+	})
+}
+
+func (s *claudineService) GetBroadcasterToken(ctx context.Context, channel string) (string, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var token string
+	err := s.store.View(func(tx Tx) error {
+		bucket, err := GetActiveChannelBucket(tx, channel)
+		if err != nil {
+			return err
+		}
+
+		raw := bucket.Get(broadcasterTokenKey)
+		if raw == nil {
+			return ErrNotFound
+		}
+		token = string(raw)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// MakeBroadcasterTokenHandler saves (PUT) or removes (DELETE) a channel's
+// broadcaster token. Tokens are never read back. Requests must carry the admin
+// token as a bearer token.
+func MakeBroadcasterTokenHandler(s Service, adminToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, adminToken) {
+			encodeError(r.Context(), ErrUnauthorized, w)
+			return
+		}
+
+		channel := r.URL.Query().Get("channel")
+		if channel == "" {
+			encodeError(r.Context(), ErrInvalidArgument, w)
+			return
+		}
+
+		var body struct {
+			Token string `json:"token"`
+		}
+		if r.Method == http.MethodPut {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+				encodeError(r.Context(), ErrInvalidArgument, w)
+				return
+			}
+		}
+
+		if err := s.SetBroadcasterToken(r.Context(), channel, body.Token); err != nil {
+			encodeError(r.Context(), err, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
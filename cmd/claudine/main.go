@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	bolt "github.com/etcd-io/bbolt"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rcole5/claudine-bot"
 	"github.com/rcole5/claudine-bot/bot"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -23,42 +32,237 @@ func main() {
 		logger = log.NewLogfmtLogger(os.Stderr)
 		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
 		logger = log.With(logger, "caller", log.DefaultCaller)
+		logger = level.NewFilter(logger, levelOption(os.Getenv("LOG_LEVEL")))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := restore(os.Args[2:]); err != nil {
+			logger.Log("restore", "failed", "err", err)
+			os.Exit(1)
+		}
+		logger.Log("restore", "complete")
+		return
 	}
 
 	// Open up the db
-	db, err := bolt.Open("claudine-commands.db", 0777, nil)
+	store, err := openStore(os.Getenv("STORE"), os.Getenv("DB_PATH"))
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+
+	// Bring the schema up to date before anything reads from it
+	if err := claudine_bot.Migrate(store, log.With(logger, "component", "migrate")); err != nil {
+		panic(err)
+	}
 
 	var s claudine_bot.Service
 	{
-		s = claudine_bot.NewClaudineService(db)
+		s = claudine_bot.NewClaudineService(store, log.With(logger, "component", "service"))
+		s = claudine_bot.LoggingMiddleware(log.With(logger, "component", "service"))(s)
+		s = claudine_bot.InstrumentingMiddleware(
+			kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+				Namespace: "claudine",
+				Subsystem: "service",
+				Name:      "request_count",
+				Help:      "Number of service requests received.",
+			}, []string{"method", "error"}),
+			kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+				Namespace: "claudine",
+				Subsystem: "service",
+				Name:      "request_latency_seconds",
+				Help:      "Total duration of service requests in seconds.",
+			}, []string{"method", "error"}),
+		)(s)
+	}
+
+	claudine_bot.AllowPrivateWebhooks = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+	if claudine_bot.AllowPrivateWebhooks {
+		level.Warn(logger).Log("msg", "webhooks can be sent to private addresses")
 	}
+	webhooks := claudine_bot.NewWebhookDispatcher(s, nil, log.With(logger, "component", "webhooks"))
+	bot.Webhooks = webhooks
+	s = claudine_bot.WebhookMiddleware(webhooks)(s)
 
 	var h http.Handler
 	{
-		h = claudine_bot.MakeHTTPHandler(s, log.With(logger, "component", "HTTP"))
+		m := http.NewServeMux()
+		m.Handle("/metrics", promhttp.Handler())
+		m.Handle("/api/v1/admin/backup", claudine_bot.MakeBackupHandler(store, os.Getenv("ADMIN_TOKEN"), log.With(logger, "component", "backup")))
+		m.Handle("/api/v1/admin/broadcaster-token", claudine_bot.MakeBroadcasterTokenHandler(s, os.Getenv("ADMIN_TOKEN")))
+		m.Handle("/api/v1/admin/bot-accounts", claudine_bot.MakeBotAccountHandler(s, os.Getenv("ADMIN_TOKEN")))
+		m.Handle("/api/v1/webhooks/test", claudine_bot.MakeWebhookTestHandler(webhooks, os.Getenv("ADMIN_TOKEN")))
+		m.Handle("/api/v1/events", claudine_bot.MakeEventsHandler(bot.Events))
+		m.Handle("/healthz", claudine_bot.MakeHealthHandler(map[string]claudine_bot.HealthCheck{
+			"database": claudine_bot.DatabaseCheck(store),
+		}))
+		m.Handle("/readyz", claudine_bot.MakeHealthHandler(map[string]claudine_bot.HealthCheck{
+			"database": claudine_bot.DatabaseCheck(store),
+			"irc":      bot.CheckIRC,
+			"helix":    bot.CheckHelix,
+		}))
+
+		// Posting to chat goes through the bot, so it sits in front of the
+		// service's API
+		api := mux.NewRouter()
+		api.Path("/api/v1/channels/{channel}/say").Handler(claudine_bot.MakeSayHandler(s, bot.Say, os.Getenv("ADMIN_TOKEN")))
+		api.PathPrefix("/").Handler(claudine_bot.MakeHTTPHandler(s, os.Getenv("ADMIN_TOKEN"), log.With(logger, "component", "HTTP")))
+		m.Handle("/", api)
+		h = m
 	}
 
-	go bot.New(s, os.Getenv("USERNAME"), os.Getenv("TOKEN"), db)
+	ctx, stopBot := context.WithCancel(context.Background())
+	botDone := make(chan struct{})
+	go func() {
+		bot.New(ctx, s, os.Getenv("USERNAME"), os.Getenv("TOKEN"), log.With(logger, "component", "bot"))
+		close(botDone)
+	}()
+
+	webhooksDone := make(chan struct{})
+	go func() {
+		webhooks.Run(ctx)
+		close(webhooksDone)
+	}()
+
+	if _, ok := store.(claudine_bot.Snapshotter); !ok && os.Getenv("BACKUP_DIR") != "" {
+		level.Warn(logger).Log("msg", "scheduled backups are only supported for bolt, ignoring BACKUP_DIR")
+	} else if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		backuper := claudine_bot.NewBackuper(store, dir, backupKeep(), backupInterval(), log.With(logger, "component", "backup"))
+		go backuper.Run(ctx)
+	}
 
 	errs := make(chan error)
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		errs <- fmt.Errorf("%s", <-c)
 	}()
 
-	go func() {
+	var srv *http.Server
+	{
 		headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type"})
 		originsOk := handlers.AllowedOrigins([]string{"*"})
 		methodsOk := handlers.AllowedMethods([]string{"GET", "POST", "DELETE", "PUT"})
 
-		logger.Log("transport", "HTTP", "addr", ":"+os.Getenv("PORT"))
-		errs <- http.ListenAndServe(":"+os.Getenv("PORT"), handlers.CORS(headersOk, originsOk, methodsOk)(h))
+		srv = &http.Server{
+			Addr:    ":" + os.Getenv("PORT"),
+			Handler: handlers.CORS(headersOk, originsOk, methodsOk)(h),
+		}
+	}
+
+	go func() {
+		logger.Log("transport", "HTTP", "addr", srv.Addr)
+		errs <- srv.ListenAndServe()
 	}()
 
 	logger.Log("exit", <-errs)
+
+	// Drain HTTP requests first, then stop the bot, and close the db last so
+	// nothing is cut off mid-write. Event streams never go idle so they're
+	// ended first.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+
+	bot.Events.Close()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Log("transport", "HTTP", "during", "shutdown", "err", err)
+	}
+
+	stopBot()
+	select {
+	case <-botDone:
+	case <-shutdownCtx.Done():
+		logger.Log("component", "bot", "during", "shutdown", "err", shutdownCtx.Err())
+	}
+
+	// Undelivered webhooks stay queued for the next start
+	select {
+	case <-webhooksDone:
+	case <-shutdownCtx.Done():
+		logger.Log("component", "webhooks", "during", "shutdown", "err", shutdownCtx.Err())
+	}
+
+	if err := store.Close(); err != nil {
+		logger.Log("component", "db", "during", "shutdown", "err", err)
+	}
+}
+
+// openStore opens the storage backend named by STORE, which is either bolt
+// (the default) or sqlite.
+func openStore(backend string, path string) (claudine_bot.Store, error) {
+	switch strings.ToLower(backend) {
+	case "sqlite":
+		if path == "" {
+			path = "claudine-commands.sqlite"
+		}
+		return claudine_bot.NewSQLiteStore(path)
+	case "", "bolt":
+		if path == "" {
+			path = "claudine-commands.db"
+		}
+		db, err := bolt.Open(path, 0777, nil)
+		if err != nil {
+			return nil, err
+		}
+		return claudine_bot.NewBoltStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", backend)
+	}
+}
+
+// restore swaps a backup in for the bolt database. Usage: claudine restore <file>
+func restore(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: claudine restore <file>")
+	}
+	if backend := strings.ToLower(os.Getenv("STORE")); backend != "" && backend != "bolt" {
+		return fmt.Errorf("restore is only supported for bolt, not %q", backend)
+	}
+
+	path := os.Getenv("DB_PATH")
+	if path == "" {
+		path = "claudine-commands.db"
+	}
+	return claudine_bot.RestoreBackup(args[0], path)
+}
+
+// backupInterval reads BACKUP_INTERVAL, defaulting to a day.
+func backupInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("BACKUP_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return 24 * time.Hour
+	}
+	return interval
+}
+
+// backupKeep reads BACKUP_KEEP, defaulting to 7 backups.
+func backupKeep() int {
+	keep, err := strconv.Atoi(os.Getenv("BACKUP_KEEP"))
+	if err != nil || keep <= 0 {
+		return 7
+	}
+	return keep
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT, defaulting to 10 seconds.
+func shutdownTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		return 10 * time.Second
+	}
+	return timeout
+}
+
+// levelOption converts a LOG_LEVEL value into a filter option, defaulting to info.
+func levelOption(name string) level.Option {
+	switch strings.ToLower(name) {
+	case "debug":
+		return level.AllowDebug()
+	case "warn":
+		return level.AllowWarn()
+	case "error":
+		return level.AllowError()
+	default:
+		return level.AllowInfo()
+	}
 }
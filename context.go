@@ -0,0 +1,52 @@
+package claudine_bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// RequestIDHeader is read from incoming HTTP requests and echoed back in responses.
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestID returns a copy of ctx carrying the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDToContext uses the caller's request ID if they sent one, otherwise a new one.
+func requestIDToContext(ctx context.Context, r *http.Request) context.Context {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = NewRequestID()
+	}
+	return WithRequestID(ctx, id)
+}
+
+// requestIDToResponse echoes the request ID back to the caller.
+func requestIDToResponse(ctx context.Context, w http.ResponseWriter) context.Context {
+	if id := RequestIDFromContext(ctx); id != "" {
+		w.Header().Set(RequestIDHeader, id)
+	}
+	return ctx
+}
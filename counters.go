@@ -0,0 +1,175 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+var countersBucket = []byte("counters")
+
+// Counter names are lowercase so chat commands aren't case sensitive.
+var counterNameRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Counter is a named number per channel, such as a death counter.
+type Counter struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func normaliseCounterName(name string) (string, error) {
+	name = strings.ToLower(name)
+	if !counterNameRegexp.MatchString(name) {
+		return "", ErrInvalidArgument
+	}
+	return name, nil
+}
+
+func (s *claudineService) NewCounter(ctx context.Context, channel string, name string) (Counter, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	name, err := normaliseCounterName(name)
+	if err != nil {
+		return Counter{}, err
+	}
+
+	c := Counter{Name: name}
+	err = s.store.Update(func(tx Tx) error {
+		cBucket, err := getChannelSubBucket(tx, channel, countersBucket, true)
+		if err != nil {
+			return err
+		}
+
+		if cBucket.Get([]byte(name)) != nil {
+			return ErrAlreadyExist
+		}
+
+		return putJSON(cBucket, []byte(name), c)
+	})
+	if err != nil {
+		return Counter{}, err
+	}
+
+	return c, nil
+}
+
+func (s *claudineService) GetCounter(ctx context.Context, channel string, name string) (Counter, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var c Counter
+	err := s.store.View(func(tx Tx) error {
+		cBucket, err := getChannelSubBucket(tx, channel, countersBucket, false)
+		if err != nil {
+			return err
+		}
+		if cBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(cBucket, []byte(strings.ToLower(name)), &c)
+	})
+	if err != nil {
+		return Counter{}, err
+	}
+
+	return c, nil
+}
+
+func (s *claudineService) ListCounter(ctx context.Context, channel string) ([]Counter, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Counter
+	err := s.store.View(func(tx Tx) error {
+		cBucket, err := getChannelSubBucket(tx, channel, countersBucket, false)
+		if err != nil || cBucket == nil {
+			return err
+		}
+
+		return cBucket.ForEach(func(name, raw []byte) error {
+			var c Counter
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return err
+			}
+			list = append(list, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return []Counter{}, err
+	}
+
+	return list, nil
+}
+
+// updateCounter applies fn to an existing counter and saves the result.
+func (s *claudineService) updateCounter(channel string, name string, fn func(c *Counter)) (Counter, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var c Counter
+	err := s.store.Update(func(tx Tx) error {
+		cBucket, err := getChannelSubBucket(tx, channel, countersBucket, false)
+		if err != nil {
+			return err
+		}
+		if cBucket == nil {
+			return ErrNotFound
+		}
+
+		key := []byte(strings.ToLower(name))
+		if err := getJSON(cBucket, key, &c); err != nil {
+			return err
+		}
+
+		fn(&c)
+		return putJSON(cBucket, key, c)
+	})
+	if err != nil {
+		return Counter{}, err
+	}
+
+	return c, nil
+}
+
+func (s *claudineService) IncrementCounter(ctx context.Context, channel string, name string, delta int) (Counter, error) {
+	return s.updateCounter(channel, name, func(c *Counter) {
+		c.Value += delta
+	})
+}
+
+func (s *claudineService) SetCounter(ctx context.Context, channel string, name string, value int) (Counter, error) {
+	return s.updateCounter(channel, name, func(c *Counter) {
+		c.Value = value
+	})
+}
+
+func (s *claudineService) ResetCounter(ctx context.Context, channel string, name string) (Counter, error) {
+	return s.updateCounter(channel, name, func(c *Counter) {
+		c.Value = 0
+	})
+}
+
+func (s *claudineService) DeleteCounter(ctx context.Context, channel string, name string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		cBucket, err := getChannelSubBucket(tx, channel, countersBucket, false)
+		if err != nil {
+			return err
+		}
+		if cBucket == nil {
+			return ErrNotFound
+		}
+
+		key := []byte(strings.ToLower(name))
+		if cBucket.Get(key) == nil {
+			return ErrNotFound
+		}
+		return cBucket.Delete(key)
+	})
+}
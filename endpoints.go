@@ -2,6 +2,7 @@ package claudine_bot
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/go-kit/kit/endpoint"
 )
 
@@ -20,6 +21,51 @@ type Endpoints struct {
 	GetRepeatEndpoint    endpoint.Endpoint
 	ListRepeatEndpoint   endpoint.Endpoint
 	DeleteRepeatEndpoint endpoint.Endpoint
+
+	GetSettingsEndpoint    endpoint.Endpoint
+	UpdateSettingsEndpoint endpoint.Endpoint
+
+	NewCounterEndpoint       endpoint.Endpoint
+	GetCounterEndpoint       endpoint.Endpoint
+	ListCounterEndpoint      endpoint.Endpoint
+	IncrementCounterEndpoint endpoint.Endpoint
+	SetCounterEndpoint       endpoint.Endpoint
+	ResetCounterEndpoint     endpoint.Endpoint
+	DeleteCounterEndpoint    endpoint.Endpoint
+
+	NewQuoteEndpoint    endpoint.Endpoint
+	GetQuoteEndpoint    endpoint.Endpoint
+	ListQuoteEndpoint   endpoint.Endpoint
+	UpdateQuoteEndpoint endpoint.Endpoint
+	DeleteQuoteEndpoint endpoint.Endpoint
+
+	GetPointsEndpoint  endpoint.Endpoint
+	ListPointsEndpoint endpoint.Endpoint
+
+	GetRaffleEndpoint  endpoint.Endpoint
+	ListRaffleEndpoint endpoint.Endpoint
+
+	GetPollEndpoint  endpoint.Endpoint
+	ListPollEndpoint endpoint.Endpoint
+
+	ListSongEndpoint    endpoint.Endpoint
+	CurrentSongEndpoint endpoint.Endpoint
+	NextSongEndpoint    endpoint.Endpoint
+	DeleteSongEndpoint  endpoint.Endpoint
+
+	ListModActionEndpoint endpoint.Endpoint
+
+	SetEventResponseEndpoint    endpoint.Endpoint
+	GetEventResponseEndpoint    endpoint.Endpoint
+	ListEventResponseEndpoint   endpoint.Endpoint
+	DeleteEventResponseEndpoint endpoint.Endpoint
+
+	AddWebhookEndpoint              endpoint.Endpoint
+	ListWebhookEndpoint             endpoint.Endpoint
+	DeleteWebhookEndpoint           endpoint.Endpoint
+	ListWebhookDeadLetterEndpoint   endpoint.Endpoint
+	DeleteWebhookDeadLetterEndpoint endpoint.Endpoint
+	ListWebhookAttemptEndpoint      endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service) Endpoints {
@@ -38,6 +84,51 @@ func MakeServerEndpoints(s Service) Endpoints {
 		GetRepeatEndpoint:  MakeGetRepeatEndpoint(s),
 		ListRepeatEndpoint: MakeListRepeatEndpoint(s),
 		DeleteRepeatEndpoint: MakeDeleteRepeatEndpoint(s),
+
+		GetSettingsEndpoint:    MakeGetSettingsEndpoint(s),
+		UpdateSettingsEndpoint: MakeUpdateSettingsEndpoint(s),
+
+		NewCounterEndpoint:       MakeNewCounterEndpoint(s),
+		GetCounterEndpoint:       MakeGetCounterEndpoint(s),
+		ListCounterEndpoint:      MakeListCounterEndpoint(s),
+		IncrementCounterEndpoint: MakeIncrementCounterEndpoint(s),
+		SetCounterEndpoint:       MakeSetCounterEndpoint(s),
+		ResetCounterEndpoint:     MakeResetCounterEndpoint(s),
+		DeleteCounterEndpoint:    MakeDeleteCounterEndpoint(s),
+
+		NewQuoteEndpoint:    MakeNewQuoteEndpoint(s),
+		GetQuoteEndpoint:    MakeGetQuoteEndpoint(s),
+		ListQuoteEndpoint:   MakeListQuoteEndpoint(s),
+		UpdateQuoteEndpoint: MakeUpdateQuoteEndpoint(s),
+		DeleteQuoteEndpoint: MakeDeleteQuoteEndpoint(s),
+
+		GetPointsEndpoint:  MakeGetPointsEndpoint(s),
+		ListPointsEndpoint: MakeListPointsEndpoint(s),
+
+		GetRaffleEndpoint:  MakeGetRaffleEndpoint(s),
+		ListRaffleEndpoint: MakeListRaffleEndpoint(s),
+
+		GetPollEndpoint:  MakeGetPollEndpoint(s),
+		ListPollEndpoint: MakeListPollEndpoint(s),
+
+		ListSongEndpoint:    MakeListSongEndpoint(s),
+		CurrentSongEndpoint: MakeCurrentSongEndpoint(s),
+		NextSongEndpoint:    MakeNextSongEndpoint(s),
+		DeleteSongEndpoint:  MakeDeleteSongEndpoint(s),
+
+		ListModActionEndpoint: MakeListModActionEndpoint(s),
+
+		SetEventResponseEndpoint:    MakeSetEventResponseEndpoint(s),
+		GetEventResponseEndpoint:    MakeGetEventResponseEndpoint(s),
+		ListEventResponseEndpoint:   MakeListEventResponseEndpoint(s),
+		DeleteEventResponseEndpoint: MakeDeleteEventResponseEndpoint(s),
+
+		AddWebhookEndpoint:              MakeAddWebhookEndpoint(s),
+		ListWebhookEndpoint:             MakeListWebhookEndpoint(s),
+		DeleteWebhookEndpoint:           MakeDeleteWebhookEndpoint(s),
+		ListWebhookDeadLetterEndpoint:   MakeListWebhookDeadLetterEndpoint(s),
+		DeleteWebhookDeadLetterEndpoint: MakeDeleteWebhookDeadLetterEndpoint(s),
+		ListWebhookAttemptEndpoint:      MakeListWebhookAttemptEndpoint(s),
 	}
 }
 
@@ -187,6 +278,297 @@ func MakeDeleteRepeatEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+func MakeGetSettingsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSettingsRequest)
+		resp, e := s.GetSettings(ctx, req.Channel)
+		return settingsResponse{Settings: resp, Error: e}, nil
+	}
+}
+
+func MakeUpdateSettingsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateSettingsRequest)
+		resp, e := s.UpdateSettings(ctx, req.Channel, req.Settings)
+		return settingsResponse{Settings: resp, Error: e}, nil
+	}
+}
+
+func MakeNewCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(newCounterRequest)
+		c, e := s.NewCounter(ctx, req.Channel, req.Name)
+		return counterResponse{Counter: c, Error: e}, nil
+	}
+}
+
+func MakeGetCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getCounterRequest)
+		c, e := s.GetCounter(ctx, req.Channel, req.Name)
+		return counterResponse{Counter: c, Error: e}, nil
+	}
+}
+
+func MakeListCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listCounterRequest)
+		c, e := s.ListCounter(ctx, req.Channel)
+		return listCounterResponse{Counters: c, Error: e}, nil
+	}
+}
+
+func MakeIncrementCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(incrementCounterRequest)
+		c, e := s.IncrementCounter(ctx, req.Channel, req.Name, req.Delta)
+		return counterResponse{Counter: c, Error: e}, nil
+	}
+}
+
+func MakeSetCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(setCounterRequest)
+		c, e := s.SetCounter(ctx, req.Channel, req.Name, req.Value)
+		return counterResponse{Counter: c, Error: e}, nil
+	}
+}
+
+func MakeResetCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(resetCounterRequest)
+		c, e := s.ResetCounter(ctx, req.Channel, req.Name)
+		return counterResponse{Counter: c, Error: e}, nil
+	}
+}
+
+func MakeDeleteCounterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteCounterRequest)
+		e := s.DeleteCounter(ctx, req.Channel, req.Name)
+		return deleteCounterResponse{Error: e}, nil
+	}
+}
+
+func MakeNewQuoteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(newQuoteRequest)
+		q, e := s.NewQuote(ctx, req.Channel, req.Quote)
+		return quoteResponse{Quote: q, Error: e}, nil
+	}
+}
+
+func MakeGetQuoteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getQuoteRequest)
+		q, e := s.GetQuote(ctx, req.Channel, req.ID)
+		return quoteResponse{Quote: q, Error: e}, nil
+	}
+}
+
+// MakeListQuoteEndpoint lists every quote, or only those containing the search text.
+func MakeListQuoteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listQuoteRequest)
+		if req.Search != "" {
+			q, e := s.SearchQuote(ctx, req.Channel, req.Search)
+			return listQuoteResponse{Quotes: q, Error: e}, nil
+		}
+		q, e := s.ListQuote(ctx, req.Channel)
+		return listQuoteResponse{Quotes: q, Error: e}, nil
+	}
+}
+
+func MakeUpdateQuoteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateQuoteRequest)
+		q, e := s.UpdateQuote(ctx, req.Channel, req.ID, req.Text)
+		return quoteResponse{Quote: q, Error: e}, nil
+	}
+}
+
+func MakeDeleteQuoteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteQuoteRequest)
+		e := s.DeleteQuote(ctx, req.Channel, req.ID)
+		return deleteQuoteResponse{Error: e}, nil
+	}
+}
+
+func MakeGetPointsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getPointsRequest)
+		p, e := s.GetPoints(ctx, req.Channel, req.User)
+		return pointsResponse{Points: p, Error: e}, nil
+	}
+}
+
+// MakeListPointsEndpoint returns the channel's points leaderboard.
+func MakeListPointsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listPointsRequest)
+		p, e := s.ListPoints(ctx, req.Channel, req.Limit)
+		return listPointsResponse{Points: p, Error: e}, nil
+	}
+}
+
+func MakeGetRaffleEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getRaffleRequest)
+		r, e := s.GetRaffle(ctx, req.Channel, req.ID)
+		return raffleResponse{Raffle: r, Error: e}, nil
+	}
+}
+
+func MakeListRaffleEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listRaffleRequest)
+		r, e := s.ListRaffle(ctx, req.Channel)
+		return listRaffleResponse{Raffles: r, Error: e}, nil
+	}
+}
+
+func MakeGetPollEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getPollRequest)
+		p, e := s.GetPoll(ctx, req.Channel, req.ID)
+		return pollResponse{Poll: p, Error: e}, nil
+	}
+}
+
+func MakeListPollEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listPollRequest)
+		p, e := s.ListPoll(ctx, req.Channel)
+		return listPollResponse{Polls: p, Error: e}, nil
+	}
+}
+
+func MakeListSongEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listSongRequest)
+		q, e := s.ListSong(ctx, req.Channel)
+		return listSongResponse{Songs: q, Error: e}, nil
+	}
+}
+
+func MakeCurrentSongEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(currentSongRequest)
+		song, e := s.CurrentSong(ctx, req.Channel)
+		return songResponse{Song: song, Error: e}, nil
+	}
+}
+
+// MakeNextSongEndpoint lets a player page take the next song off the queue.
+func MakeNextSongEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(nextSongRequest)
+		song, e := s.NextSong(ctx, req.Channel)
+		return songResponse{Song: song, Error: e}, nil
+	}
+}
+
+func MakeDeleteSongEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteSongRequest)
+		e := s.DeleteSong(ctx, req.Channel, req.ID)
+		return deleteSongResponse{Error: e}, nil
+	}
+}
+
+func MakeListModActionEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listModActionRequest)
+		a, e := s.ListModAction(ctx, req.Channel, req.Query)
+		return listModActionResponse{Actions: a, Error: e}, nil
+	}
+}
+
+func MakeSetEventResponseEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(setEventResponseRequest)
+		r, e := s.SetEventResponse(ctx, req.Channel, req.Response)
+		return eventResponseResponse{Response: r, Error: e}, nil
+	}
+}
+
+func MakeGetEventResponseEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getEventResponseRequest)
+		r, e := s.GetEventResponse(ctx, req.Channel, req.Event)
+		return eventResponseResponse{Response: r, Error: e}, nil
+	}
+}
+
+func MakeListEventResponseEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listEventResponseRequest)
+		r, e := s.ListEventResponse(ctx, req.Channel)
+		return listEventResponseResponse{Responses: r, Error: e}, nil
+	}
+}
+
+func MakeDeleteEventResponseEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteEventResponseRequest)
+		e := s.DeleteEventResponse(ctx, req.Channel, req.Event)
+		return deleteEventResponseResponse{Error: e}, nil
+	}
+}
+
+func MakeAddWebhookEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(addWebhookRequest)
+		w, e := s.AddWebhook(ctx, req.Channel, req.Webhook)
+		return webhookResponse{Webhook: w, Error: e}, nil
+	}
+}
+
+func MakeListWebhookEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listWebhookRequest)
+		w, e := s.ListWebhook(ctx, req.Channel)
+		// Secrets are only shown when a webhook is added
+		for i := range w {
+			w[i].Secret = ""
+		}
+		return listWebhookResponse{Webhooks: w, Error: e}, nil
+	}
+}
+
+func MakeDeleteWebhookEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteWebhookRequest)
+		e := s.DeleteWebhook(ctx, req.Channel, req.ID)
+		return deleteWebhookResponse{Error: e}, nil
+	}
+}
+
+func MakeListWebhookDeadLetterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listWebhookDeadLetterRequest)
+		d, e := s.ListWebhookDeadLetter(ctx, req.Channel)
+		return listWebhookDeadLetterResponse{DeadLetters: d, Error: e}, nil
+	}
+}
+
+func MakeDeleteWebhookDeadLetterEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteWebhookDeadLetterRequest)
+		e := s.DeleteWebhookDeadLetter(ctx, req.Channel, req.ID)
+		return deleteWebhookResponse{Error: e}, nil
+	}
+}
+
+func MakeListWebhookAttemptEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listWebhookAttemptRequest)
+		a, e := s.ListWebhookAttempt(ctx, req.Channel, req.Query)
+		return listWebhookAttemptResponse{Attempts: a, Error: e}, nil
+	}
+}
+
 // New Command
 type newCommandRequest struct {
 	Command Command
@@ -304,3 +686,327 @@ type deleteRepeatResponse struct {
 }
 
 func (r getCommandResponse) error() error { return r.Error }
+
+type getSettingsRequest struct {
+	Channel string `json:"channel"`
+}
+
+type updateSettingsRequest struct {
+	Channel string
+	// Settings are applied over the channel's current settings.
+	Settings json.RawMessage
+}
+
+type settingsResponse struct {
+	Settings ChannelSettings `json:"settings"`
+	Error    error           `json:"error,omitempty"`
+}
+
+func (r settingsResponse) error() error { return r.Error }
+
+type newCounterRequest struct {
+	Channel string `json:"-"`
+	Name    string `json:"name"`
+}
+
+type getCounterRequest struct {
+	Channel string
+	Name    string
+}
+
+type listCounterRequest struct {
+	Channel string
+}
+
+type incrementCounterRequest struct {
+	Channel string `json:"-"`
+	Name    string `json:"-"`
+	Delta   int    `json:"delta"`
+}
+
+type setCounterRequest struct {
+	Channel string `json:"-"`
+	Name    string `json:"-"`
+	Value   int    `json:"value"`
+}
+
+type resetCounterRequest struct {
+	Channel string
+	Name    string
+}
+
+type deleteCounterRequest struct {
+	Channel string
+	Name    string
+}
+
+type counterResponse struct {
+	Counter Counter `json:"counter"`
+	Error   error   `json:"error,omitempty"`
+}
+
+type listCounterResponse struct {
+	Counters []Counter `json:"counters"`
+	Error    error     `json:"error,omitempty"`
+}
+
+type deleteCounterResponse struct {
+	Error error `json:"error,omitempty"`
+}
+
+func (r counterResponse) error() error       { return r.Error }
+func (r listCounterResponse) error() error   { return r.Error }
+func (r deleteCounterResponse) error() error { return r.Error }
+
+type newQuoteRequest struct {
+	Channel string
+	Quote   Quote
+}
+
+type getQuoteRequest struct {
+	Channel string
+	ID      int
+}
+
+type listQuoteRequest struct {
+	Channel string
+	Search  string
+}
+
+type updateQuoteRequest struct {
+	Channel string `json:"-"`
+	ID      int    `json:"-"`
+	Text    string `json:"text"`
+}
+
+type deleteQuoteRequest struct {
+	Channel string
+	ID      int
+}
+
+type quoteResponse struct {
+	Quote Quote `json:"quote"`
+	Error error `json:"error,omitempty"`
+}
+
+type listQuoteResponse struct {
+	Quotes []Quote `json:"quotes"`
+	Error  error   `json:"error,omitempty"`
+}
+
+type deleteQuoteResponse struct {
+	Error error `json:"error,omitempty"`
+}
+
+func (r quoteResponse) error() error       { return r.Error }
+func (r listQuoteResponse) error() error   { return r.Error }
+func (r deleteQuoteResponse) error() error { return r.Error }
+
+type getPointsRequest struct {
+	Channel string
+	User    string
+}
+
+type listPointsRequest struct {
+	Channel string
+	Limit   int
+}
+
+type pointsResponse struct {
+	Points Points `json:"points"`
+	Error  error  `json:"error,omitempty"`
+}
+
+type listPointsResponse struct {
+	Points []Points `json:"points"`
+	Error  error    `json:"error,omitempty"`
+}
+
+func (r pointsResponse) error() error     { return r.Error }
+func (r listPointsResponse) error() error { return r.Error }
+
+type getRaffleRequest struct {
+	Channel string
+	ID      int
+}
+
+type listRaffleRequest struct {
+	Channel string
+}
+
+type raffleResponse struct {
+	Raffle Raffle `json:"raffle"`
+	Error  error  `json:"error,omitempty"`
+}
+
+type listRaffleResponse struct {
+	Raffles []Raffle `json:"raffles"`
+	Error   error    `json:"error,omitempty"`
+}
+
+func (r raffleResponse) error() error     { return r.Error }
+func (r listRaffleResponse) error() error { return r.Error }
+
+type getPollRequest struct {
+	Channel string
+	ID      int
+}
+
+type listPollRequest struct {
+	Channel string
+}
+
+type pollResponse struct {
+	Poll  Poll  `json:"poll"`
+	Error error `json:"error,omitempty"`
+}
+
+type listPollResponse struct {
+	Polls []Poll `json:"polls"`
+	Error error  `json:"error,omitempty"`
+}
+
+func (r pollResponse) error() error     { return r.Error }
+func (r listPollResponse) error() error { return r.Error }
+
+type listSongRequest struct {
+	Channel string
+}
+
+type currentSongRequest struct {
+	Channel string
+}
+
+type nextSongRequest struct {
+	Channel string
+}
+
+type deleteSongRequest struct {
+	Channel string
+	ID      int
+}
+
+type songResponse struct {
+	Song  Song  `json:"song"`
+	Error error `json:"error,omitempty"`
+}
+
+type listSongResponse struct {
+	Songs []Song `json:"songs"`
+	Error error  `json:"error,omitempty"`
+}
+
+type deleteSongResponse struct {
+	Error error `json:"error,omitempty"`
+}
+
+func (r songResponse) error() error       { return r.Error }
+func (r listSongResponse) error() error   { return r.Error }
+func (r deleteSongResponse) error() error { return r.Error }
+
+type listModActionRequest struct {
+	Channel string
+	Query   ModActionQuery
+}
+
+type listModActionResponse struct {
+	Actions []ModAction `json:"actions"`
+	Error   error       `json:"error,omitempty"`
+}
+
+func (r listModActionResponse) error() error { return r.Error }
+
+type setEventResponseRequest struct {
+	Channel  string
+	Response EventResponse
+}
+
+type getEventResponseRequest struct {
+	Channel string
+	Event   string
+}
+
+type listEventResponseRequest struct {
+	Channel string
+}
+
+type deleteEventResponseRequest struct {
+	Channel string
+	Event   string
+}
+
+type eventResponseResponse struct {
+	Response EventResponse `json:"response"`
+	Error    error         `json:"error,omitempty"`
+}
+
+type listEventResponseResponse struct {
+	Responses []EventResponse `json:"responses"`
+	Error     error           `json:"error,omitempty"`
+}
+
+type deleteEventResponseResponse struct {
+	Error error `json:"error,omitempty"`
+}
+
+func (r eventResponseResponse) error() error       { return r.Error }
+func (r listEventResponseResponse) error() error   { return r.Error }
+func (r deleteEventResponseResponse) error() error { return r.Error }
+
+type addWebhookRequest struct {
+	Channel string
+	Webhook Webhook
+}
+
+type listWebhookRequest struct {
+	Channel string
+}
+
+type deleteWebhookRequest struct {
+	Channel string
+	ID      int
+}
+
+type listWebhookDeadLetterRequest struct {
+	Channel string
+}
+
+type deleteWebhookDeadLetterRequest struct {
+	Channel string
+	ID      int
+}
+
+type listWebhookAttemptRequest struct {
+	Channel string
+	Query   WebhookAttemptQuery
+}
+
+type webhookResponse struct {
+	Webhook Webhook `json:"webhook"`
+	Error   error   `json:"error,omitempty"`
+}
+
+type listWebhookResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Error    error     `json:"error,omitempty"`
+}
+
+type deleteWebhookResponse struct {
+	Error error `json:"error,omitempty"`
+}
+
+type listWebhookDeadLetterResponse struct {
+	DeadLetters []WebhookDeadLetter `json:"dead_letters"`
+	Error       error               `json:"error,omitempty"`
+}
+
+type listWebhookAttemptResponse struct {
+	Attempts []WebhookAttempt `json:"attempts"`
+	Error    error            `json:"error,omitempty"`
+}
+
+func (r webhookResponse) error() error               { return r.Error }
+func (r listWebhookResponse) error() error           { return r.Error }
+func (r deleteWebhookResponse) error() error         { return r.Error }
+func (r listWebhookDeadLetterResponse) error() error { return r.Error }
+func (r listWebhookAttemptResponse) error() error    { return r.Error }
@@ -0,0 +1,131 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+var eventResponsesBucket = []byte("event_responses")
+
+// Stream events the bot can respond to in chat.
+const (
+	EventFollow      = "follow"
+	EventSub         = "sub"
+	EventResub       = "resub"
+	EventSubGift     = "subgift"
+	EventMysteryGift = "submysterygift"
+	EventRaid        = "raid"
+	EventCheer       = "cheer"
+)
+
+// EventResponse is the message posted when a stream event happens. The
+// template can use the event's variables, such as {{.User}} or {{.Months}}.
+type EventResponse struct {
+	Event    string `json:"event"`
+	Template string `json:"template"`
+	Enabled  bool   `json:"enabled"`
+}
+
+func validEvent(event string) bool {
+	switch event {
+	case EventFollow, EventSub, EventResub, EventSubGift, EventMysteryGift, EventRaid, EventCheer:
+		return true
+	}
+	return false
+}
+
+func (s *claudineService) SetEventResponse(ctx context.Context, channel string, r EventResponse) (EventResponse, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r.Event = strings.ToLower(r.Event)
+	if !validEvent(r.Event) || strings.TrimSpace(r.Template) == "" {
+		return EventResponse{}, ErrInvalidArgument
+	}
+
+	err := s.store.Update(func(tx Tx) error {
+		eBucket, err := getChannelSubBucket(tx, channel, eventResponsesBucket, true)
+		if err != nil {
+			return err
+		}
+
+		return putJSON(eBucket, []byte(r.Event), r)
+	})
+	if err != nil {
+		return EventResponse{}, err
+	}
+
+	return r, nil
+}
+
+func (s *claudineService) GetEventResponse(ctx context.Context, channel string, event string) (EventResponse, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var r EventResponse
+	err := s.store.View(func(tx Tx) error {
+		eBucket, err := getChannelSubBucket(tx, channel, eventResponsesBucket, false)
+		if err != nil {
+			return err
+		}
+		if eBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(eBucket, []byte(strings.ToLower(event)), &r)
+	})
+	if err != nil {
+		return EventResponse{}, err
+	}
+
+	return r, nil
+}
+
+func (s *claudineService) ListEventResponse(ctx context.Context, channel string) ([]EventResponse, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []EventResponse
+	err := s.store.View(func(tx Tx) error {
+		eBucket, err := getChannelSubBucket(tx, channel, eventResponsesBucket, false)
+		if err != nil || eBucket == nil {
+			return err
+		}
+
+		return eBucket.ForEach(func(event, raw []byte) error {
+			var r EventResponse
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return err
+			}
+			list = append(list, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return []EventResponse{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) DeleteEventResponse(ctx context.Context, channel string, event string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		eBucket, err := getChannelSubBucket(tx, channel, eventResponsesBucket, false)
+		if err != nil {
+			return err
+		}
+		if eBucket == nil {
+			return ErrNotFound
+		}
+
+		key := []byte(strings.ToLower(event))
+		if eBucket.Get(key) == nil {
+			return ErrNotFound
+		}
+		return eBucket.Delete(key)
+	})
+}
@@ -0,0 +1,141 @@
+package claudine_bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of events buffered per subscriber before new ones are dropped.
+const eventBuffer = 32
+
+// How often an idle event stream sends a comment to keep proxies from closing it.
+const eventKeepAlive = 30 * time.Second
+
+// Event is something that happened in a channel, such as a poll vote, streamed
+// to overlays.
+type Event struct {
+	Type    string      `json:"type"`
+	Channel string      `json:"channel"`
+	Data    interface{} `json:"data"`
+	Time    time.Time   `json:"time"`
+}
+
+// EventBus fans events out to the subscribers of each channel.
+type EventBus struct {
+	mtx    sync.Mutex
+	subs   map[chan Event]string
+	closed bool
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs: make(map[chan Event]string),
+	}
+}
+
+// Publish sends an event to the channel's subscribers without blocking. Slow
+// subscribers miss events rather than holding up the bot.
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	channel := strings.ToLower(e.Channel)
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for sub, subChannel := range b.subs {
+		if subChannel != channel {
+			continue
+		}
+		select {
+		case sub <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the events of a channel until cancel is called or the bus
+// is closed.
+func (b *EventBus) Subscribe(channel string) (events <-chan Event, cancel func()) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	sub := make(chan Event, eventBuffer)
+	if b.closed {
+		close(sub)
+		return sub, func() {}
+	}
+	b.subs[sub] = strings.ToLower(channel)
+
+	return sub, func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		if _, ok := b.subs[sub]; ok {
+			delete(b.subs, sub)
+			close(sub)
+		}
+	}
+}
+
+// Close ends every subscription so open streams finish before shutdown.
+func (b *EventBus) Close() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub)
+	}
+}
+
+// MakeEventsHandler streams a channel's events as server-sent events:
+//
+//	GET /api/v1/events?channel=name
+func MakeEventsHandler(bus *EventBus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel := r.URL.Query().Get("channel")
+		if channel == "" {
+			http.Error(w, "channel is required", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		events, cancel := bus.Subscribe(channel)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			}
+			flusher.Flush()
+		}
+	})
+}
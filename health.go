@@ -0,0 +1,61 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// How long all the checks of a single health request may take.
+const healthTimeout = 5 * time.Second
+
+// HealthCheck returns an error if the component it checks is unhealthy.
+type HealthCheck func(ctx context.Context) error
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]healthStatus `json:"checks"`
+}
+
+// MakeHealthHandler runs every check and responds with a JSON breakdown. The
+// response is a 503 if any check fails.
+func MakeHealthHandler(checks map[string]HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+
+		resp := healthResponse{
+			Status: "ok",
+			Checks: make(map[string]healthStatus),
+		}
+		code := http.StatusOK
+		for name, check := range checks {
+			if err := check(ctx); err != nil {
+				resp.Checks[name] = healthStatus{Status: "unavailable", Error: err.Error()}
+				resp.Status = "unavailable"
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[name] = healthStatus{Status: "ok"}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// DatabaseCheck checks that a read transaction can be opened on the store.
+func DatabaseCheck(store Store) HealthCheck {
+	return func(ctx context.Context) error {
+		return store.View(func(tx Tx) error {
+			return nil
+		})
+	}
+}
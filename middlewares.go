@@ -1 +1,859 @@
 package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	"time"
+)
+
+// Middleware describes a service middleware.
+type Middleware func(Service) Service
+
+// LoggingMiddleware logs the method, channel, duration and error of every service call.
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Service) Service {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Service
+	logger log.Logger
+}
+
+// log writes failed calls as errors and the rest at debug, so the bot's
+// polling doesn't fill the log.
+func (mw loggingMiddleware) log(ctx context.Context, method string, channel string, begin time.Time, err error) {
+	logger := level.Debug(mw.logger)
+	if err != nil {
+		logger = level.Error(mw.logger)
+	}
+	logger.Log(
+		"method", method,
+		"channel", channel,
+		"request_id", RequestIDFromContext(ctx),
+		"took", time.Since(begin),
+		"err", err,
+	)
+}
+
+func (mw loggingMiddleware) NewChannel(ctx context.Context, channel string) (c Channel, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NewChannel", channel, begin, err) }(time.Now())
+	return mw.next.NewChannel(ctx, channel)
+}
+
+func (mw loggingMiddleware) ListChannel(ctx context.Context) (c []Channel, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListChannel", "", begin, err) }(time.Now())
+	return mw.next.ListChannel(ctx)
+}
+
+func (mw loggingMiddleware) DeleteChannel(ctx context.Context, channel string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteChannel", channel, begin, err) }(time.Now())
+	return mw.next.DeleteChannel(ctx, channel)
+}
+
+func (mw loggingMiddleware) NewCommand(ctx context.Context, channel string, c Command) (command Command, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NewCommand", channel, begin, err) }(time.Now())
+	return mw.next.NewCommand(ctx, channel, c)
+}
+
+func (mw loggingMiddleware) GetCommand(ctx context.Context, channel string, trigger string) (c Command, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetCommand", channel, begin, err) }(time.Now())
+	return mw.next.GetCommand(ctx, channel, trigger)
+}
+
+func (mw loggingMiddleware) ListCommand(ctx context.Context, channel string) (c []Command, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListCommand", channel, begin, err) }(time.Now())
+	return mw.next.ListCommand(ctx, channel)
+}
+
+func (mw loggingMiddleware) UpdateCommand(ctx context.Context, channel string, trigger string, action string) (c Command, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "UpdateCommand", channel, begin, err) }(time.Now())
+	return mw.next.UpdateCommand(ctx, channel, trigger, action)
+}
+
+func (mw loggingMiddleware) DeleteCommand(ctx context.Context, channel string, trigger string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteCommand", channel, begin, err) }(time.Now())
+	return mw.next.DeleteCommand(ctx, channel, trigger)
+}
+
+func (mw loggingMiddleware) NewRepeatCommand(ctx context.Context, channel string, trigger string, duration int) (c RepeatCommand, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NewRepeatCommand", channel, begin, err) }(time.Now())
+	return mw.next.NewRepeatCommand(ctx, channel, trigger, duration)
+}
+
+func (mw loggingMiddleware) GetRepeatCommand(ctx context.Context, channel string, trigger string) (c RepeatCommand, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetRepeatCommand", channel, begin, err) }(time.Now())
+	return mw.next.GetRepeatCommand(ctx, channel, trigger)
+}
+
+func (mw loggingMiddleware) ListRepeatCommand(ctx context.Context, channel string) (c []RepeatCommand, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListRepeatCommand", channel, begin, err) }(time.Now())
+	return mw.next.ListRepeatCommand(ctx, channel)
+}
+
+func (mw loggingMiddleware) DeleteRepeatCommand(ctx context.Context, channel string, trigger string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteRepeatCommand", channel, begin, err) }(time.Now())
+	return mw.next.DeleteRepeatCommand(ctx, channel, trigger)
+}
+
+func (mw loggingMiddleware) GetSettings(ctx context.Context, channel string) (s ChannelSettings, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetSettings", channel, begin, err) }(time.Now())
+	return mw.next.GetSettings(ctx, channel)
+}
+
+func (mw loggingMiddleware) UpdateSettings(ctx context.Context, channel string, patch json.RawMessage) (s ChannelSettings, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "UpdateSettings", channel, begin, err) }(time.Now())
+	return mw.next.UpdateSettings(ctx, channel, patch)
+}
+
+func (mw loggingMiddleware) NewCounter(ctx context.Context, channel string, name string) (c Counter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NewCounter", channel, begin, err) }(time.Now())
+	return mw.next.NewCounter(ctx, channel, name)
+}
+
+func (mw loggingMiddleware) GetCounter(ctx context.Context, channel string, name string) (c Counter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetCounter", channel, begin, err) }(time.Now())
+	return mw.next.GetCounter(ctx, channel, name)
+}
+
+func (mw loggingMiddleware) ListCounter(ctx context.Context, channel string) (c []Counter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListCounter", channel, begin, err) }(time.Now())
+	return mw.next.ListCounter(ctx, channel)
+}
+
+func (mw loggingMiddleware) IncrementCounter(ctx context.Context, channel string, name string, delta int) (c Counter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "IncrementCounter", channel, begin, err) }(time.Now())
+	return mw.next.IncrementCounter(ctx, channel, name, delta)
+}
+
+func (mw loggingMiddleware) SetCounter(ctx context.Context, channel string, name string, value int) (c Counter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "SetCounter", channel, begin, err) }(time.Now())
+	return mw.next.SetCounter(ctx, channel, name, value)
+}
+
+func (mw loggingMiddleware) ResetCounter(ctx context.Context, channel string, name string) (c Counter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ResetCounter", channel, begin, err) }(time.Now())
+	return mw.next.ResetCounter(ctx, channel, name)
+}
+
+func (mw loggingMiddleware) DeleteCounter(ctx context.Context, channel string, name string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteCounter", channel, begin, err) }(time.Now())
+	return mw.next.DeleteCounter(ctx, channel, name)
+}
+
+func (mw loggingMiddleware) NewQuote(ctx context.Context, channel string, q Quote) (quote Quote, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NewQuote", channel, begin, err) }(time.Now())
+	return mw.next.NewQuote(ctx, channel, q)
+}
+
+func (mw loggingMiddleware) GetQuote(ctx context.Context, channel string, id int) (q Quote, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetQuote", channel, begin, err) }(time.Now())
+	return mw.next.GetQuote(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) ListQuote(ctx context.Context, channel string) (q []Quote, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListQuote", channel, begin, err) }(time.Now())
+	return mw.next.ListQuote(ctx, channel)
+}
+
+func (mw loggingMiddleware) SearchQuote(ctx context.Context, channel string, text string) (q []Quote, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "SearchQuote", channel, begin, err) }(time.Now())
+	return mw.next.SearchQuote(ctx, channel, text)
+}
+
+func (mw loggingMiddleware) UpdateQuote(ctx context.Context, channel string, id int, text string) (q Quote, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "UpdateQuote", channel, begin, err) }(time.Now())
+	return mw.next.UpdateQuote(ctx, channel, id, text)
+}
+
+func (mw loggingMiddleware) DeleteQuote(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteQuote", channel, begin, err) }(time.Now())
+	return mw.next.DeleteQuote(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) GetPoints(ctx context.Context, channel string, user string) (p Points, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetPoints", channel, begin, err) }(time.Now())
+	return mw.next.GetPoints(ctx, channel, user)
+}
+
+func (mw loggingMiddleware) AddPoints(ctx context.Context, channel string, users []string, amount int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "AddPoints", channel, begin, err) }(time.Now())
+	return mw.next.AddPoints(ctx, channel, users, amount)
+}
+
+func (mw loggingMiddleware) GivePoints(ctx context.Context, channel string, from string, to string, amount int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GivePoints", channel, begin, err) }(time.Now())
+	return mw.next.GivePoints(ctx, channel, from, to, amount)
+}
+
+func (mw loggingMiddleware) ListPoints(ctx context.Context, channel string, limit int) (p []Points, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListPoints", channel, begin, err) }(time.Now())
+	return mw.next.ListPoints(ctx, channel, limit)
+}
+
+func (mw loggingMiddleware) OpenRaffle(ctx context.Context, channel string, r Raffle) (raffle Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "OpenRaffle", channel, begin, err) }(time.Now())
+	return mw.next.OpenRaffle(ctx, channel, r)
+}
+
+func (mw loggingMiddleware) CurrentRaffle(ctx context.Context, channel string) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "CurrentRaffle", channel, begin, err) }(time.Now())
+	return mw.next.CurrentRaffle(ctx, channel)
+}
+
+func (mw loggingMiddleware) GetRaffle(ctx context.Context, channel string, id int) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetRaffle", channel, begin, err) }(time.Now())
+	return mw.next.GetRaffle(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) ListRaffle(ctx context.Context, channel string) (r []Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListRaffle", channel, begin, err) }(time.Now())
+	return mw.next.ListRaffle(ctx, channel)
+}
+
+func (mw loggingMiddleware) EnterRaffle(ctx context.Context, channel string, user string, subscriber bool) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "EnterRaffle", channel, begin, err) }(time.Now())
+	return mw.next.EnterRaffle(ctx, channel, user, subscriber)
+}
+
+func (mw loggingMiddleware) CloseRaffle(ctx context.Context, channel string, id int) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "CloseRaffle", channel, begin, err) }(time.Now())
+	return mw.next.CloseRaffle(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) DrawRaffle(ctx context.Context, channel string, id int, count int, seed int64) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DrawRaffle", channel, begin, err) }(time.Now())
+	return mw.next.DrawRaffle(ctx, channel, id, count, seed)
+}
+
+func (mw loggingMiddleware) NewPoll(ctx context.Context, channel string, p Poll) (poll Poll, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NewPoll", channel, begin, err) }(time.Now())
+	return mw.next.NewPoll(ctx, channel, p)
+}
+
+func (mw loggingMiddleware) CurrentPoll(ctx context.Context, channel string) (p Poll, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "CurrentPoll", channel, begin, err) }(time.Now())
+	return mw.next.CurrentPoll(ctx, channel)
+}
+
+func (mw loggingMiddleware) GetPoll(ctx context.Context, channel string, id int) (p Poll, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetPoll", channel, begin, err) }(time.Now())
+	return mw.next.GetPoll(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) ListPoll(ctx context.Context, channel string) (p []Poll, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListPoll", channel, begin, err) }(time.Now())
+	return mw.next.ListPoll(ctx, channel)
+}
+
+func (mw loggingMiddleware) VotePoll(ctx context.Context, channel string, userID string, option int) (p Poll, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "VotePoll", channel, begin, err) }(time.Now())
+	return mw.next.VotePoll(ctx, channel, userID, option)
+}
+
+func (mw loggingMiddleware) ClosePoll(ctx context.Context, channel string, id int) (p Poll, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ClosePoll", channel, begin, err) }(time.Now())
+	return mw.next.ClosePoll(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) RequestSong(ctx context.Context, channel string, song Song) (s Song, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "RequestSong", channel, begin, err) }(time.Now())
+	return mw.next.RequestSong(ctx, channel, song)
+}
+
+func (mw loggingMiddleware) ListSong(ctx context.Context, channel string) (s []Song, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListSong", channel, begin, err) }(time.Now())
+	return mw.next.ListSong(ctx, channel)
+}
+
+func (mw loggingMiddleware) CurrentSong(ctx context.Context, channel string) (s Song, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "CurrentSong", channel, begin, err) }(time.Now())
+	return mw.next.CurrentSong(ctx, channel)
+}
+
+func (mw loggingMiddleware) NextSong(ctx context.Context, channel string) (s Song, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "NextSong", channel, begin, err) }(time.Now())
+	return mw.next.NextSong(ctx, channel)
+}
+
+func (mw loggingMiddleware) DeleteSong(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteSong", channel, begin, err) }(time.Now())
+	return mw.next.DeleteSong(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) LogModAction(ctx context.Context, channel string, a ModAction) (action ModAction, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "LogModAction", channel, begin, err) }(time.Now())
+	return mw.next.LogModAction(ctx, channel, a)
+}
+
+func (mw loggingMiddleware) ListModAction(ctx context.Context, channel string, q ModActionQuery) (a []ModAction, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListModAction", channel, begin, err) }(time.Now())
+	return mw.next.ListModAction(ctx, channel, q)
+}
+
+func (mw loggingMiddleware) SetEventResponse(ctx context.Context, channel string, r EventResponse) (response EventResponse, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "SetEventResponse", channel, begin, err) }(time.Now())
+	return mw.next.SetEventResponse(ctx, channel, r)
+}
+
+func (mw loggingMiddleware) GetEventResponse(ctx context.Context, channel string, event string) (r EventResponse, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetEventResponse", channel, begin, err) }(time.Now())
+	return mw.next.GetEventResponse(ctx, channel, event)
+}
+
+func (mw loggingMiddleware) ListEventResponse(ctx context.Context, channel string) (r []EventResponse, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListEventResponse", channel, begin, err) }(time.Now())
+	return mw.next.ListEventResponse(ctx, channel)
+}
+
+func (mw loggingMiddleware) DeleteEventResponse(ctx context.Context, channel string, event string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteEventResponse", channel, begin, err) }(time.Now())
+	return mw.next.DeleteEventResponse(ctx, channel, event)
+}
+
+func (mw loggingMiddleware) SetBroadcasterToken(ctx context.Context, channel string, token string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "SetBroadcasterToken", channel, begin, err) }(time.Now())
+	return mw.next.SetBroadcasterToken(ctx, channel, token)
+}
+
+func (mw loggingMiddleware) GetBroadcasterToken(ctx context.Context, channel string) (token string, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetBroadcasterToken", channel, begin, err) }(time.Now())
+	return mw.next.GetBroadcasterToken(ctx, channel)
+}
+
+func (mw loggingMiddleware) AddWebhook(ctx context.Context, channel string, w Webhook) (webhook Webhook, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "AddWebhook", channel, begin, err) }(time.Now())
+	return mw.next.AddWebhook(ctx, channel, w)
+}
+
+func (mw loggingMiddleware) ListWebhook(ctx context.Context, channel string) (w []Webhook, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListWebhook", channel, begin, err) }(time.Now())
+	return mw.next.ListWebhook(ctx, channel)
+}
+
+func (mw loggingMiddleware) DeleteWebhook(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteWebhook", channel, begin, err) }(time.Now())
+	return mw.next.DeleteWebhook(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) ListWebhookDeadLetter(ctx context.Context, channel string) (d []WebhookDeadLetter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListWebhookDeadLetter", channel, begin, err) }(time.Now())
+	return mw.next.ListWebhookDeadLetter(ctx, channel)
+}
+
+func (mw loggingMiddleware) DeleteWebhookDeadLetter(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteWebhookDeadLetter", channel, begin, err) }(time.Now())
+	return mw.next.DeleteWebhookDeadLetter(ctx, channel, id)
+}
+
+// WebhookMiddleware sends command changes to the channel's webhooks.
+func WebhookMiddleware(d *WebhookDispatcher) Middleware {
+	return func(next Service) Service {
+		return &webhookMiddleware{
+			Service:    next,
+			dispatcher: d,
+		}
+	}
+}
+
+// webhookMiddleware only overrides the methods it sends events for.
+type webhookMiddleware struct {
+	Service
+	dispatcher *WebhookDispatcher
+}
+
+func (mw webhookMiddleware) notify(channel string, event string, c Command, message string) {
+	mw.dispatcher.Notify(channel, WebhookVariables{
+		Event:   event,
+		Channel: channel,
+		URL:     "https://twitch.tv/" + channel,
+		Command: &c,
+		Message: message,
+		Time:    time.Now().UTC(),
+	})
+}
+
+func (mw webhookMiddleware) NewCommand(ctx context.Context, channel string, c Command) (Command, error) {
+	command, err := mw.Service.NewCommand(ctx, channel, c)
+	if err == nil {
+		mw.notify(channel, EventCommandAdded, command, "Command "+command.Trigger+" was added.")
+	}
+	return command, err
+}
+
+func (mw webhookMiddleware) UpdateCommand(ctx context.Context, channel string, trigger string, action string) (Command, error) {
+	command, err := mw.Service.UpdateCommand(ctx, channel, trigger, action)
+	if err == nil {
+		mw.notify(channel, EventCommandUpdated, command, "Command "+command.Trigger+" was updated.")
+	}
+	return command, err
+}
+
+func (mw webhookMiddleware) DeleteCommand(ctx context.Context, channel string, trigger string) error {
+	err := mw.Service.DeleteCommand(ctx, channel, trigger)
+	if err == nil {
+		mw.notify(channel, EventCommandDeleted, Command{Trigger: trigger}, "Command "+trigger+" was deleted.")
+	}
+	return err
+}
+
+func (mw loggingMiddleware) GetWebhook(ctx context.Context, channel string, id int) (w Webhook, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetWebhook", channel, begin, err) }(time.Now())
+	return mw.next.GetWebhook(ctx, channel, id)
+}
+
+func (mw loggingMiddleware) QueueWebhookDelivery(ctx context.Context, d WebhookDelivery) (delivery WebhookDelivery, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "QueueWebhookDelivery", d.Channel, begin, err) }(time.Now())
+	return mw.next.QueueWebhookDelivery(ctx, d)
+}
+
+func (mw loggingMiddleware) DueWebhookDelivery(ctx context.Context, now time.Time, limit int) (d []WebhookDelivery, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DueWebhookDelivery", "", begin, err) }(time.Now())
+	return mw.next.DueWebhookDelivery(ctx, now, limit)
+}
+
+func (mw loggingMiddleware) RetryWebhookDelivery(ctx context.Context, d WebhookDelivery) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "RetryWebhookDelivery", d.Channel, begin, err) }(time.Now())
+	return mw.next.RetryWebhookDelivery(ctx, d)
+}
+
+func (mw loggingMiddleware) DeleteWebhookDelivery(ctx context.Context, id int) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteWebhookDelivery", "", begin, err) }(time.Now())
+	return mw.next.DeleteWebhookDelivery(ctx, id)
+}
+
+func (mw loggingMiddleware) DeadLetterWebhookDelivery(ctx context.Context, d WebhookDelivery) (deadLetter WebhookDeadLetter, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeadLetterWebhookDelivery", d.Channel, begin, err) }(time.Now())
+	return mw.next.DeadLetterWebhookDelivery(ctx, d)
+}
+
+func (mw loggingMiddleware) LogWebhookAttempt(ctx context.Context, channel string, a WebhookAttempt) (attempt WebhookAttempt, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "LogWebhookAttempt", channel, begin, err) }(time.Now())
+	return mw.next.LogWebhookAttempt(ctx, channel, a)
+}
+
+func (mw loggingMiddleware) ListWebhookAttempt(ctx context.Context, channel string, q WebhookAttemptQuery) (a []WebhookAttempt, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListWebhookAttempt", channel, begin, err) }(time.Now())
+	return mw.next.ListWebhookAttempt(ctx, channel, q)
+}
+
+func (mw loggingMiddleware) SetBotAccount(ctx context.Context, a BotAccount) (account BotAccount, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "SetBotAccount", "", begin, err) }(time.Now())
+	return mw.next.SetBotAccount(ctx, a)
+}
+
+func (mw loggingMiddleware) GetBotAccount(ctx context.Context, name string) (a BotAccount, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "GetBotAccount", "", begin, err) }(time.Now())
+	return mw.next.GetBotAccount(ctx, name)
+}
+
+func (mw loggingMiddleware) ListBotAccount(ctx context.Context) (a []BotAccount, err error) {
+	defer func(begin time.Time) { mw.log(ctx, "ListBotAccount", "", begin, err) }(time.Now())
+	return mw.next.ListBotAccount(ctx)
+}
+
+func (mw loggingMiddleware) DeleteBotAccount(ctx context.Context, name string) (err error) {
+	defer func(begin time.Time) { mw.log(ctx, "DeleteBotAccount", "", begin, err) }(time.Now())
+	return mw.next.DeleteBotAccount(ctx, name)
+}
+
+// InstrumentingMiddleware counts and times every service call by method and error.
+func InstrumentingMiddleware(requestCount metrics.Counter, requestLatency metrics.Histogram) Middleware {
+	return func(next Service) Service {
+		return &instrumentingMiddleware{
+			next:           next,
+			requestCount:   requestCount,
+			requestLatency: requestLatency,
+		}
+	}
+}
+
+type instrumentingMiddleware struct {
+	next           Service
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+}
+
+func (mw instrumentingMiddleware) observe(method string, begin time.Time, err error) {
+	lvs := []string{"method", method, "error", fmt.Sprint(err != nil)}
+	mw.requestCount.With(lvs...).Add(1)
+	mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+}
+
+func (mw instrumentingMiddleware) NewChannel(ctx context.Context, channel string) (c Channel, err error) {
+	defer func(begin time.Time) { mw.observe("NewChannel", begin, err) }(time.Now())
+	return mw.next.NewChannel(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) ListChannel(ctx context.Context) (c []Channel, err error) {
+	defer func(begin time.Time) { mw.observe("ListChannel", begin, err) }(time.Now())
+	return mw.next.ListChannel(ctx)
+}
+
+func (mw instrumentingMiddleware) DeleteChannel(ctx context.Context, channel string) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteChannel", begin, err) }(time.Now())
+	return mw.next.DeleteChannel(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) NewCommand(ctx context.Context, channel string, c Command) (command Command, err error) {
+	defer func(begin time.Time) { mw.observe("NewCommand", begin, err) }(time.Now())
+	return mw.next.NewCommand(ctx, channel, c)
+}
+
+func (mw instrumentingMiddleware) GetCommand(ctx context.Context, channel string, trigger string) (c Command, err error) {
+	defer func(begin time.Time) { mw.observe("GetCommand", begin, err) }(time.Now())
+	return mw.next.GetCommand(ctx, channel, trigger)
+}
+
+func (mw instrumentingMiddleware) ListCommand(ctx context.Context, channel string) (c []Command, err error) {
+	defer func(begin time.Time) { mw.observe("ListCommand", begin, err) }(time.Now())
+	return mw.next.ListCommand(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) UpdateCommand(ctx context.Context, channel string, trigger string, action string) (c Command, err error) {
+	defer func(begin time.Time) { mw.observe("UpdateCommand", begin, err) }(time.Now())
+	return mw.next.UpdateCommand(ctx, channel, trigger, action)
+}
+
+func (mw instrumentingMiddleware) DeleteCommand(ctx context.Context, channel string, trigger string) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteCommand", begin, err) }(time.Now())
+	return mw.next.DeleteCommand(ctx, channel, trigger)
+}
+
+func (mw instrumentingMiddleware) NewRepeatCommand(ctx context.Context, channel string, trigger string, duration int) (c RepeatCommand, err error) {
+	defer func(begin time.Time) { mw.observe("NewRepeatCommand", begin, err) }(time.Now())
+	return mw.next.NewRepeatCommand(ctx, channel, trigger, duration)
+}
+
+func (mw instrumentingMiddleware) GetRepeatCommand(ctx context.Context, channel string, trigger string) (c RepeatCommand, err error) {
+	defer func(begin time.Time) { mw.observe("GetRepeatCommand", begin, err) }(time.Now())
+	return mw.next.GetRepeatCommand(ctx, channel, trigger)
+}
+
+func (mw instrumentingMiddleware) ListRepeatCommand(ctx context.Context, channel string) (c []RepeatCommand, err error) {
+	defer func(begin time.Time) { mw.observe("ListRepeatCommand", begin, err) }(time.Now())
+	return mw.next.ListRepeatCommand(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) DeleteRepeatCommand(ctx context.Context, channel string, trigger string) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteRepeatCommand", begin, err) }(time.Now())
+	return mw.next.DeleteRepeatCommand(ctx, channel, trigger)
+}
+
+func (mw instrumentingMiddleware) GetSettings(ctx context.Context, channel string) (s ChannelSettings, err error) {
+	defer func(begin time.Time) { mw.observe("GetSettings", begin, err) }(time.Now())
+	return mw.next.GetSettings(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) UpdateSettings(ctx context.Context, channel string, patch json.RawMessage) (s ChannelSettings, err error) {
+	defer func(begin time.Time) { mw.observe("UpdateSettings", begin, err) }(time.Now())
+	return mw.next.UpdateSettings(ctx, channel, patch)
+}
+
+func (mw instrumentingMiddleware) NewCounter(ctx context.Context, channel string, name string) (c Counter, err error) {
+	defer func(begin time.Time) { mw.observe("NewCounter", begin, err) }(time.Now())
+	return mw.next.NewCounter(ctx, channel, name)
+}
+
+func (mw instrumentingMiddleware) GetCounter(ctx context.Context, channel string, name string) (c Counter, err error) {
+	defer func(begin time.Time) { mw.observe("GetCounter", begin, err) }(time.Now())
+	return mw.next.GetCounter(ctx, channel, name)
+}
+
+func (mw instrumentingMiddleware) ListCounter(ctx context.Context, channel string) (c []Counter, err error) {
+	defer func(begin time.Time) { mw.observe("ListCounter", begin, err) }(time.Now())
+	return mw.next.ListCounter(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) IncrementCounter(ctx context.Context, channel string, name string, delta int) (c Counter, err error) {
+	defer func(begin time.Time) { mw.observe("IncrementCounter", begin, err) }(time.Now())
+	return mw.next.IncrementCounter(ctx, channel, name, delta)
+}
+
+func (mw instrumentingMiddleware) SetCounter(ctx context.Context, channel string, name string, value int) (c Counter, err error) {
+	defer func(begin time.Time) { mw.observe("SetCounter", begin, err) }(time.Now())
+	return mw.next.SetCounter(ctx, channel, name, value)
+}
+
+func (mw instrumentingMiddleware) ResetCounter(ctx context.Context, channel string, name string) (c Counter, err error) {
+	defer func(begin time.Time) { mw.observe("ResetCounter", begin, err) }(time.Now())
+	return mw.next.ResetCounter(ctx, channel, name)
+}
+
+func (mw instrumentingMiddleware) DeleteCounter(ctx context.Context, channel string, name string) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteCounter", begin, err) }(time.Now())
+	return mw.next.DeleteCounter(ctx, channel, name)
+}
+
+func (mw instrumentingMiddleware) NewQuote(ctx context.Context, channel string, q Quote) (quote Quote, err error) {
+	defer func(begin time.Time) { mw.observe("NewQuote", begin, err) }(time.Now())
+	return mw.next.NewQuote(ctx, channel, q)
+}
+
+func (mw instrumentingMiddleware) GetQuote(ctx context.Context, channel string, id int) (q Quote, err error) {
+	defer func(begin time.Time) { mw.observe("GetQuote", begin, err) }(time.Now())
+	return mw.next.GetQuote(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) ListQuote(ctx context.Context, channel string) (q []Quote, err error) {
+	defer func(begin time.Time) { mw.observe("ListQuote", begin, err) }(time.Now())
+	return mw.next.ListQuote(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) SearchQuote(ctx context.Context, channel string, text string) (q []Quote, err error) {
+	defer func(begin time.Time) { mw.observe("SearchQuote", begin, err) }(time.Now())
+	return mw.next.SearchQuote(ctx, channel, text)
+}
+
+func (mw instrumentingMiddleware) UpdateQuote(ctx context.Context, channel string, id int, text string) (q Quote, err error) {
+	defer func(begin time.Time) { mw.observe("UpdateQuote", begin, err) }(time.Now())
+	return mw.next.UpdateQuote(ctx, channel, id, text)
+}
+
+func (mw instrumentingMiddleware) DeleteQuote(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteQuote", begin, err) }(time.Now())
+	return mw.next.DeleteQuote(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) GetPoints(ctx context.Context, channel string, user string) (p Points, err error) {
+	defer func(begin time.Time) { mw.observe("GetPoints", begin, err) }(time.Now())
+	return mw.next.GetPoints(ctx, channel, user)
+}
+
+func (mw instrumentingMiddleware) AddPoints(ctx context.Context, channel string, users []string, amount int) (err error) {
+	defer func(begin time.Time) { mw.observe("AddPoints", begin, err) }(time.Now())
+	return mw.next.AddPoints(ctx, channel, users, amount)
+}
+
+func (mw instrumentingMiddleware) GivePoints(ctx context.Context, channel string, from string, to string, amount int) (err error) {
+	defer func(begin time.Time) { mw.observe("GivePoints", begin, err) }(time.Now())
+	return mw.next.GivePoints(ctx, channel, from, to, amount)
+}
+
+func (mw instrumentingMiddleware) ListPoints(ctx context.Context, channel string, limit int) (p []Points, err error) {
+	defer func(begin time.Time) { mw.observe("ListPoints", begin, err) }(time.Now())
+	return mw.next.ListPoints(ctx, channel, limit)
+}
+
+func (mw instrumentingMiddleware) OpenRaffle(ctx context.Context, channel string, r Raffle) (raffle Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("OpenRaffle", begin, err) }(time.Now())
+	return mw.next.OpenRaffle(ctx, channel, r)
+}
+
+func (mw instrumentingMiddleware) CurrentRaffle(ctx context.Context, channel string) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("CurrentRaffle", begin, err) }(time.Now())
+	return mw.next.CurrentRaffle(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) GetRaffle(ctx context.Context, channel string, id int) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("GetRaffle", begin, err) }(time.Now())
+	return mw.next.GetRaffle(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) ListRaffle(ctx context.Context, channel string) (r []Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("ListRaffle", begin, err) }(time.Now())
+	return mw.next.ListRaffle(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) EnterRaffle(ctx context.Context, channel string, user string, subscriber bool) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("EnterRaffle", begin, err) }(time.Now())
+	return mw.next.EnterRaffle(ctx, channel, user, subscriber)
+}
+
+func (mw instrumentingMiddleware) CloseRaffle(ctx context.Context, channel string, id int) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("CloseRaffle", begin, err) }(time.Now())
+	return mw.next.CloseRaffle(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) DrawRaffle(ctx context.Context, channel string, id int, count int, seed int64) (r Raffle, err error) {
+	defer func(begin time.Time) { mw.observe("DrawRaffle", begin, err) }(time.Now())
+	return mw.next.DrawRaffle(ctx, channel, id, count, seed)
+}
+
+func (mw instrumentingMiddleware) NewPoll(ctx context.Context, channel string, p Poll) (poll Poll, err error) {
+	defer func(begin time.Time) { mw.observe("NewPoll", begin, err) }(time.Now())
+	return mw.next.NewPoll(ctx, channel, p)
+}
+
+func (mw instrumentingMiddleware) CurrentPoll(ctx context.Context, channel string) (p Poll, err error) {
+	defer func(begin time.Time) { mw.observe("CurrentPoll", begin, err) }(time.Now())
+	return mw.next.CurrentPoll(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) GetPoll(ctx context.Context, channel string, id int) (p Poll, err error) {
+	defer func(begin time.Time) { mw.observe("GetPoll", begin, err) }(time.Now())
+	return mw.next.GetPoll(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) ListPoll(ctx context.Context, channel string) (p []Poll, err error) {
+	defer func(begin time.Time) { mw.observe("ListPoll", begin, err) }(time.Now())
+	return mw.next.ListPoll(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) VotePoll(ctx context.Context, channel string, userID string, option int) (p Poll, err error) {
+	defer func(begin time.Time) { mw.observe("VotePoll", begin, err) }(time.Now())
+	return mw.next.VotePoll(ctx, channel, userID, option)
+}
+
+func (mw instrumentingMiddleware) ClosePoll(ctx context.Context, channel string, id int) (p Poll, err error) {
+	defer func(begin time.Time) { mw.observe("ClosePoll", begin, err) }(time.Now())
+	return mw.next.ClosePoll(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) RequestSong(ctx context.Context, channel string, song Song) (s Song, err error) {
+	defer func(begin time.Time) { mw.observe("RequestSong", begin, err) }(time.Now())
+	return mw.next.RequestSong(ctx, channel, song)
+}
+
+func (mw instrumentingMiddleware) ListSong(ctx context.Context, channel string) (s []Song, err error) {
+	defer func(begin time.Time) { mw.observe("ListSong", begin, err) }(time.Now())
+	return mw.next.ListSong(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) CurrentSong(ctx context.Context, channel string) (s Song, err error) {
+	defer func(begin time.Time) { mw.observe("CurrentSong", begin, err) }(time.Now())
+	return mw.next.CurrentSong(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) NextSong(ctx context.Context, channel string) (s Song, err error) {
+	defer func(begin time.Time) { mw.observe("NextSong", begin, err) }(time.Now())
+	return mw.next.NextSong(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) DeleteSong(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteSong", begin, err) }(time.Now())
+	return mw.next.DeleteSong(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) LogModAction(ctx context.Context, channel string, a ModAction) (action ModAction, err error) {
+	defer func(begin time.Time) { mw.observe("LogModAction", begin, err) }(time.Now())
+	return mw.next.LogModAction(ctx, channel, a)
+}
+
+func (mw instrumentingMiddleware) ListModAction(ctx context.Context, channel string, q ModActionQuery) (a []ModAction, err error) {
+	defer func(begin time.Time) { mw.observe("ListModAction", begin, err) }(time.Now())
+	return mw.next.ListModAction(ctx, channel, q)
+}
+
+func (mw instrumentingMiddleware) SetEventResponse(ctx context.Context, channel string, r EventResponse) (response EventResponse, err error) {
+	defer func(begin time.Time) { mw.observe("SetEventResponse", begin, err) }(time.Now())
+	return mw.next.SetEventResponse(ctx, channel, r)
+}
+
+func (mw instrumentingMiddleware) GetEventResponse(ctx context.Context, channel string, event string) (r EventResponse, err error) {
+	defer func(begin time.Time) { mw.observe("GetEventResponse", begin, err) }(time.Now())
+	return mw.next.GetEventResponse(ctx, channel, event)
+}
+
+func (mw instrumentingMiddleware) ListEventResponse(ctx context.Context, channel string) (r []EventResponse, err error) {
+	defer func(begin time.Time) { mw.observe("ListEventResponse", begin, err) }(time.Now())
+	return mw.next.ListEventResponse(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) DeleteEventResponse(ctx context.Context, channel string, event string) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteEventResponse", begin, err) }(time.Now())
+	return mw.next.DeleteEventResponse(ctx, channel, event)
+}
+
+func (mw instrumentingMiddleware) SetBroadcasterToken(ctx context.Context, channel string, token string) (err error) {
+	defer func(begin time.Time) { mw.observe("SetBroadcasterToken", begin, err) }(time.Now())
+	return mw.next.SetBroadcasterToken(ctx, channel, token)
+}
+
+func (mw instrumentingMiddleware) GetBroadcasterToken(ctx context.Context, channel string) (token string, err error) {
+	defer func(begin time.Time) { mw.observe("GetBroadcasterToken", begin, err) }(time.Now())
+	return mw.next.GetBroadcasterToken(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) AddWebhook(ctx context.Context, channel string, w Webhook) (webhook Webhook, err error) {
+	defer func(begin time.Time) { mw.observe("AddWebhook", begin, err) }(time.Now())
+	return mw.next.AddWebhook(ctx, channel, w)
+}
+
+func (mw instrumentingMiddleware) ListWebhook(ctx context.Context, channel string) (w []Webhook, err error) {
+	defer func(begin time.Time) { mw.observe("ListWebhook", begin, err) }(time.Now())
+	return mw.next.ListWebhook(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) DeleteWebhook(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteWebhook", begin, err) }(time.Now())
+	return mw.next.DeleteWebhook(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) ListWebhookDeadLetter(ctx context.Context, channel string) (d []WebhookDeadLetter, err error) {
+	defer func(begin time.Time) { mw.observe("ListWebhookDeadLetter", begin, err) }(time.Now())
+	return mw.next.ListWebhookDeadLetter(ctx, channel)
+}
+
+func (mw instrumentingMiddleware) DeleteWebhookDeadLetter(ctx context.Context, channel string, id int) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteWebhookDeadLetter", begin, err) }(time.Now())
+	return mw.next.DeleteWebhookDeadLetter(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) GetWebhook(ctx context.Context, channel string, id int) (w Webhook, err error) {
+	defer func(begin time.Time) { mw.observe("GetWebhook", begin, err) }(time.Now())
+	return mw.next.GetWebhook(ctx, channel, id)
+}
+
+func (mw instrumentingMiddleware) QueueWebhookDelivery(ctx context.Context, d WebhookDelivery) (delivery WebhookDelivery, err error) {
+	defer func(begin time.Time) { mw.observe("QueueWebhookDelivery", begin, err) }(time.Now())
+	return mw.next.QueueWebhookDelivery(ctx, d)
+}
+
+func (mw instrumentingMiddleware) DueWebhookDelivery(ctx context.Context, now time.Time, limit int) (d []WebhookDelivery, err error) {
+	defer func(begin time.Time) { mw.observe("DueWebhookDelivery", begin, err) }(time.Now())
+	return mw.next.DueWebhookDelivery(ctx, now, limit)
+}
+
+func (mw instrumentingMiddleware) RetryWebhookDelivery(ctx context.Context, d WebhookDelivery) (err error) {
+	defer func(begin time.Time) { mw.observe("RetryWebhookDelivery", begin, err) }(time.Now())
+	return mw.next.RetryWebhookDelivery(ctx, d)
+}
+
+func (mw instrumentingMiddleware) DeleteWebhookDelivery(ctx context.Context, id int) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteWebhookDelivery", begin, err) }(time.Now())
+	return mw.next.DeleteWebhookDelivery(ctx, id)
+}
+
+func (mw instrumentingMiddleware) DeadLetterWebhookDelivery(ctx context.Context, d WebhookDelivery) (deadLetter WebhookDeadLetter, err error) {
+	defer func(begin time.Time) { mw.observe("DeadLetterWebhookDelivery", begin, err) }(time.Now())
+	return mw.next.DeadLetterWebhookDelivery(ctx, d)
+}
+
+func (mw instrumentingMiddleware) LogWebhookAttempt(ctx context.Context, channel string, a WebhookAttempt) (attempt WebhookAttempt, err error) {
+	defer func(begin time.Time) { mw.observe("LogWebhookAttempt", begin, err) }(time.Now())
+	return mw.next.LogWebhookAttempt(ctx, channel, a)
+}
+
+func (mw instrumentingMiddleware) ListWebhookAttempt(ctx context.Context, channel string, q WebhookAttemptQuery) (a []WebhookAttempt, err error) {
+	defer func(begin time.Time) { mw.observe("ListWebhookAttempt", begin, err) }(time.Now())
+	return mw.next.ListWebhookAttempt(ctx, channel, q)
+}
+
+func (mw instrumentingMiddleware) SetBotAccount(ctx context.Context, a BotAccount) (account BotAccount, err error) {
+	defer func(begin time.Time) { mw.observe("SetBotAccount", begin, err) }(time.Now())
+	return mw.next.SetBotAccount(ctx, a)
+}
+
+func (mw instrumentingMiddleware) GetBotAccount(ctx context.Context, name string) (a BotAccount, err error) {
+	defer func(begin time.Time) { mw.observe("GetBotAccount", begin, err) }(time.Now())
+	return mw.next.GetBotAccount(ctx, name)
+}
+
+func (mw instrumentingMiddleware) ListBotAccount(ctx context.Context) (a []BotAccount, err error) {
+	defer func(begin time.Time) { mw.observe("ListBotAccount", begin, err) }(time.Now())
+	return mw.next.ListBotAccount(ctx)
+}
+
+func (mw instrumentingMiddleware) DeleteBotAccount(ctx context.Context, name string) (err error) {
+	defer func(begin time.Time) { mw.observe("DeleteBotAccount", begin, err) }(time.Now())
+	return mw.next.DeleteBotAccount(ctx, name)
+}
@@ -0,0 +1,179 @@
+package claudine_bot
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"strconv"
+)
+
+var (
+	metaBucket     = []byte("meta")
+	channelsBucket = []byte("channels")
+	repeatBucket   = []byte("repeat")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of claudine")
+
+// Migration upgrades the store from the previous schema version to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(tx Tx) error
+}
+
+// Migrations are run in order. Never edit or reorder a released migration, add
+// a new one instead.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "move channels under the channels bucket and store commands as JSON",
+		Migrate:     migrateChannelsBucket,
+	},
+}
+
+// SchemaVersion returns the schema version of the store, 0 if it has never been migrated.
+func SchemaVersion(tx Tx) (int, error) {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0, nil
+	}
+
+	version := meta.Get(schemaVersionKey)
+	if version == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(version))
+}
+
+// Migrate brings the store up to the latest schema version. Each migration runs
+// in its own transaction along with the version bump.
+func Migrate(store Store, logger log.Logger) error {
+	var current int
+	err := store.View(func(tx Tx) error {
+		var err error
+		current, err = SchemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	latest := Migrations[len(Migrations)-1].Version
+	if current > latest {
+		return ErrSchemaTooNew
+	}
+
+	for _, m := range Migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		logger.Log("migration", m.Version, "description", m.Description)
+		err := store.Update(func(tx Tx) error {
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+
+			meta, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			return meta.Put(schemaVersionKey, []byte(strconv.Itoa(m.Version)))
+		})
+		if err != nil {
+			return err
+		}
+		current = m.Version
+	}
+
+	return nil
+}
+
+// migrateChannelsBucket moves every top-level channel bucket into the channels
+// bucket, converting command actions into Command JSON on the way.
+func migrateChannelsBucket(tx Tx) error {
+	root, err := tx.CreateBucketIfNotExists(channelsBucket)
+	if err != nil {
+		return err
+	}
+
+	// Collect the channels first, buckets can't be deleted while iterating
+	var channels [][]byte
+	err = tx.ForEach(func(name []byte, b Bucket) error {
+		switch string(name) {
+		case string(metaBucket), string(channelsBucket), string(repeatBucket):
+			return nil
+		}
+		if b.Get([]byte("enabled")) != nil || b.Bucket([]byte("commands")) != nil {
+			channels = append(channels, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range channels {
+		old := tx.Bucket(name)
+		channel, err := root.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+
+		err = old.ForEach(func(k, v []byte) error {
+			if v != nil {
+				return channel.Put(k, v)
+			}
+			nested, err := channel.CreateBucketIfNotExists(k)
+			if err != nil {
+				return err
+			}
+			if string(k) == "commands" {
+				return migrateCommands(nested, old.Bucket(k))
+			}
+			return copyBucket(nested, old.Bucket(k))
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateCommands(dst Bucket, src Bucket) error {
+	return src.ForEach(func(trigger, action []byte) error {
+		if action == nil {
+			return nil
+		}
+		raw, err := json.Marshal(Command{
+			Trigger: string(trigger),
+			Action:  string(action),
+		})
+		if err != nil {
+			return err
+		}
+		return dst.Put(trigger, raw)
+	})
+}
+
+// copyBucket recursively copies every key and nested bucket from src into dst.
+func copyBucket(dst Bucket, src Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
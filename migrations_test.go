@@ -0,0 +1,174 @@
+package claudine_bot_test
+
+import (
+	"context"
+	bolt "github.com/etcd-io/bbolt"
+	"github.com/go-kit/kit/log"
+	"github.com/rcole5/claudine-bot"
+	"path/filepath"
+	"testing"
+)
+
+var migrationStores = []struct {
+	name     string
+	newStore func(t *testing.T) claudine_bot.Store
+}{
+	{"Bolt", func(t *testing.T) claudine_bot.Store {
+		db, err := bolt.Open(filepath.Join(t.TempDir(), "claudine.db"), 0600, nil)
+		if err != nil {
+			t.Fatalf("open bolt: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return claudine_bot.NewBoltStore(db)
+	}},
+	{"SQLite", func(t *testing.T) claudine_bot.Store {
+		s, err := claudine_bot.NewSQLiteStore(filepath.Join(t.TempDir(), "claudine.sqlite"))
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		return s
+	}},
+}
+
+// writeUnversioned lays out a store the way it was before migrations, with
+// each channel in a top level bucket and commands stored as plain text.
+func writeUnversioned(t *testing.T, s claudine_bot.Store) {
+	err := s.Update(func(tx claudine_bot.Tx) error {
+		channels := []struct {
+			name     string
+			enabled  []byte
+			commands map[string]string
+		}{
+			{"active", []byte{1}, map[string]string{"!hi": "hello", "!bye": "see you"}},
+			{"disabled", []byte{0}, nil},
+			{"commandsonly", nil, map[string]string{"!lurk": "lurking"}},
+		}
+		for _, c := range channels {
+			b, err := tx.CreateBucketIfNotExists([]byte(c.name))
+			if err != nil {
+				return err
+			}
+			if c.enabled != nil {
+				if err := b.Put([]byte("enabled"), c.enabled); err != nil {
+					return err
+				}
+			}
+			if c.commands == nil {
+				continue
+			}
+			cb, err := b.CreateBucketIfNotExists([]byte("commands"))
+			if err != nil {
+				return err
+			}
+			for trigger, action := range c.commands {
+				if err := cb.Put([]byte(trigger), []byte(action)); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Nested buckets move with their channel
+		nested, err := tx.Bucket([]byte("active")).CreateBucketIfNotExists([]byte("counters"))
+		if err != nil {
+			return err
+		}
+		if err := nested.Put([]byte("deaths"), []byte(`{"name":"deaths","value":3}`)); err != nil {
+			return err
+		}
+
+		// Buckets that aren't channels are left where they are
+		repeat, err := tx.CreateBucketIfNotExists([]byte("repeat"))
+		if err != nil {
+			return err
+		}
+		if err := repeat.Put([]byte("active"), []byte("{}")); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte("unrelated"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("write unversioned store: %v", err)
+	}
+}
+
+func TestMigrateChannelsBucket(t *testing.T) {
+	for _, store := range migrationStores {
+		t.Run(store.name, func(t *testing.T) {
+			s := store.newStore(t)
+			writeUnversioned(t, s)
+
+			// A second run must find nothing left to do
+			for i := 0; i < 2; i++ {
+				if err := claudine_bot.Migrate(s, log.NewNopLogger()); err != nil {
+					t.Fatalf("migrate: %v", err)
+				}
+			}
+
+			err := s.View(func(tx claudine_bot.Tx) error {
+				version, err := claudine_bot.SchemaVersion(tx)
+				if err != nil {
+					return err
+				}
+				if want := claudine_bot.Migrations[len(claudine_bot.Migrations)-1].Version; version != want {
+					t.Errorf("schema version = %d, want %d", version, want)
+				}
+
+				tops := []struct {
+					name   string
+					exists bool
+				}{
+					{"active", false},
+					{"disabled", false},
+					{"commandsonly", false},
+					{"channels", true},
+					{"repeat", true},
+					{"unrelated", true},
+				}
+				for _, top := range tops {
+					if exists := tx.Bucket([]byte(top.name)) != nil; exists != top.exists {
+						t.Errorf("top level bucket %q exists = %v, want %v", top.name, exists, top.exists)
+					}
+				}
+
+				channels := tx.Bucket([]byte("channels"))
+				for _, name := range []string{"active", "disabled", "commandsonly"} {
+					if channels.Bucket([]byte(name)) == nil {
+						t.Errorf("channel %q wasn't moved", name)
+					}
+				}
+				if channels.Bucket([]byte("unrelated")) != nil {
+					t.Errorf("bucket %q was moved as a channel", "unrelated")
+				}
+				if got := channels.Bucket([]byte("active")).Bucket([]byte("counters")).Get([]byte("deaths")); string(got) != `{"name":"deaths","value":3}` {
+					t.Errorf("nested counter = %s, want it copied", got)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("view: %v", err)
+			}
+
+			svc := claudine_bot.NewClaudineService(s, log.NewNopLogger())
+			tests := []struct {
+				channel, trigger, action string
+				err                      error
+			}{
+				{"active", "!hi", "hello", nil},
+				{"active", "!bye", "see you", nil},
+				{"active", "!missing", "", claudine_bot.ErrNotFound},
+				{"disabled", "!hi", "", claudine_bot.ErrNotFound},
+			}
+			for _, test := range tests {
+				c, err := svc.GetCommand(context.Background(), test.channel, test.trigger)
+				if err != test.err {
+					t.Errorf("GetCommand(%q, %q) error = %v, want %v", test.channel, test.trigger, err, test.err)
+					continue
+				}
+				if c.Action != test.action {
+					t.Errorf("GetCommand(%q, %q) action = %q, want %q", test.channel, test.trigger, c.Action, test.action)
+				}
+			}
+		})
+	}
+}
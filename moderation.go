@@ -0,0 +1,127 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var moderationBucket = []byte("moderation")
+
+const (
+	ModActionTimeout = "timeout"
+	ModActionBan     = "ban"
+	ModActionDelete  = "delete"
+	ModActionWarning = "warning"
+)
+
+// ModAction is a moderation action taken against a user.
+type ModAction struct {
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	// Actor is the mod or bot that took the action, empty if unknown.
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+	// Duration of a timeout in seconds.
+	Duration  int       `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModActionQuery narrows down the moderation log. Empty fields match anything.
+type ModActionQuery struct {
+	Target string
+	Type   string
+	Since  time.Time
+	// Limit is the most actions returned, 0 for all.
+	Limit int
+}
+
+func (q ModActionQuery) matches(a ModAction) bool {
+	if q.Target != "" && !strings.EqualFold(q.Target, a.Target) {
+		return false
+	}
+	if q.Type != "" && q.Type != a.Type {
+		return false
+	}
+	return q.Since.IsZero() || !a.CreatedAt.Before(q.Since)
+}
+
+func validModAction(actionType string) bool {
+	switch actionType {
+	case ModActionTimeout, ModActionBan, ModActionDelete, ModActionWarning:
+		return true
+	}
+	return false
+}
+
+func (s *claudineService) LogModAction(ctx context.Context, channel string, a ModAction) (ModAction, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	a.Target = strings.ToLower(strings.TrimPrefix(a.Target, "@"))
+	a.Actor = strings.ToLower(a.Actor)
+	if a.Target == "" || !validModAction(a.Type) || a.Duration < 0 {
+		return ModAction{}, ErrInvalidArgument
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+
+	err := s.store.Update(func(tx Tx) error {
+		mBucket, err := getChannelSubBucket(tx, channel, moderationBucket, true)
+		if err != nil {
+			return err
+		}
+
+		id, err := mBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		a.ID = int(id)
+
+		return putJSON(mBucket, itob(a.ID), a)
+	})
+	if err != nil {
+		return ModAction{}, err
+	}
+
+	return a, nil
+}
+
+func (s *claudineService) ListModAction(ctx context.Context, channel string, q ModActionQuery) ([]ModAction, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []ModAction
+	err := s.store.View(func(tx Tx) error {
+		mBucket, err := getChannelSubBucket(tx, channel, moderationBucket, false)
+		if err != nil || mBucket == nil {
+			return err
+		}
+
+		return mBucket.ForEach(func(id, raw []byte) error {
+			var a ModAction
+			if err := json.Unmarshal(raw, &a); err != nil {
+				return err
+			}
+			if q.matches(a) {
+				list = append(list, a)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return []ModAction{}, err
+	}
+
+	// Newest first
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,144 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+var pointsBucket = []byte("points")
+
+// Points is a user's balance of channel currency.
+type Points struct {
+	User    string `json:"user"`
+	Balance int    `json:"balance"`
+}
+
+// getBalance reads a user's balance, users without one have none.
+func getBalance(b Bucket, user string) (Points, error) {
+	p := Points{User: user}
+	if err := getJSON(b, []byte(user), &p); err != nil && err != ErrNotFound {
+		return Points{}, err
+	}
+	return p, nil
+}
+
+func (s *claudineService) GetPoints(ctx context.Context, channel string, user string) (Points, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	user = strings.ToLower(user)
+	p := Points{User: user}
+	err := s.store.View(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pointsBucket, false)
+		if err != nil || pBucket == nil {
+			return err
+		}
+
+		p, err = getBalance(pBucket, user)
+		return err
+	})
+	if err != nil {
+		return Points{}, err
+	}
+
+	return p, nil
+}
+
+func (s *claudineService) AddPoints(ctx context.Context, channel string, users []string, amount int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pointsBucket, true)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			p, err := getBalance(pBucket, strings.ToLower(user))
+			if err != nil {
+				return err
+			}
+
+			p.Balance += amount
+			if p.Balance < 0 {
+				p.Balance = 0
+			}
+			if err := putJSON(pBucket, []byte(p.User), p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *claudineService) GivePoints(ctx context.Context, channel string, from string, to string, amount int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	from, to = strings.ToLower(from), strings.ToLower(to)
+	if amount <= 0 || from == to {
+		return ErrInvalidArgument
+	}
+
+	return s.store.Update(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pointsBucket, true)
+		if err != nil {
+			return err
+		}
+
+		sender, err := getBalance(pBucket, from)
+		if err != nil {
+			return err
+		}
+		if sender.Balance < amount {
+			return ErrInsufficientPoints
+		}
+		receiver, err := getBalance(pBucket, to)
+		if err != nil {
+			return err
+		}
+
+		sender.Balance -= amount
+		receiver.Balance += amount
+		if err := putJSON(pBucket, []byte(from), sender); err != nil {
+			return err
+		}
+		return putJSON(pBucket, []byte(to), receiver)
+	})
+}
+
+func (s *claudineService) ListPoints(ctx context.Context, channel string, limit int) ([]Points, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Points
+	err := s.store.View(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pointsBucket, false)
+		if err != nil || pBucket == nil {
+			return err
+		}
+
+		return pBucket.ForEach(func(user, raw []byte) error {
+			var p Points
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return err
+			}
+			list = append(list, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return []Points{}, err
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Balance > list[j].Balance
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,285 @@
+package claudine_bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var (
+	pollsBucket = []byte("polls")
+	// currentPollKey holds the ID of the most recently started poll.
+	currentPollKey = []byte("current")
+)
+
+// Poll is a question viewers vote on in chat.
+type Poll struct {
+	ID       int      `json:"id"`
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	// Votes maps user IDs to the index of the option they voted for.
+	Votes map[string]int `json:"votes"`
+	// Tally is the number of votes for each option.
+	Tally     []int     `json:"tally"`
+	Open      bool      `json:"open"`
+	CreatedAt time.Time `json:"created_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	ClosedAt  time.Time `json:"closed_at"`
+}
+
+// Winners returns the indexes of the options with the most votes.
+func (p Poll) Winners() []int {
+	most := 0
+	for _, n := range p.Tally {
+		if n > most {
+			most = n
+		}
+	}
+
+	var winners []int
+	for i, n := range p.Tally {
+		if n == most && most > 0 {
+			winners = append(winners, i)
+		}
+	}
+	return winners
+}
+
+// tally counts the votes for each option.
+func (p *Poll) tally() {
+	p.Tally = make([]int, len(p.Options))
+	for _, option := range p.Votes {
+		p.Tally[option]++
+	}
+}
+
+// latestPoll reads the most recently started poll.
+func latestPoll(b Bucket) (Poll, error) {
+	var p Poll
+	if id := b.Get(currentPollKey); id != nil {
+		if err := getJSON(b, id, &p); err != nil {
+			return Poll{}, err
+		}
+		return p, nil
+	}
+
+	// Polls from before the current one was kept have to be looked for
+	found := false
+	err := b.ForEach(func(id, raw []byte) error {
+		if bytes.Equal(id, currentPollKey) {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &p)
+	})
+	if err != nil {
+		return Poll{}, err
+	}
+	if !found {
+		return Poll{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (s *claudineService) NewPoll(ctx context.Context, channel string, p Poll) (Poll, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p.Question = strings.TrimSpace(p.Question)
+	var options []string
+	for _, option := range p.Options {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	if p.Question == "" || len(options) < 2 || !p.EndsAt.After(time.Now()) {
+		return Poll{}, ErrInvalidArgument
+	}
+	p.Options = options
+	p.Votes = make(map[string]int)
+	p.tally()
+	p.Open = true
+	p.CreatedAt = time.Now().UTC()
+	p.ClosedAt = time.Time{}
+
+	err := s.store.Update(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pollsBucket, true)
+		if err != nil {
+			return err
+		}
+
+		// Only one poll can run at a time
+		latest, err := latestPoll(pBucket)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if latest.Open {
+			return ErrAlreadyExist
+		}
+
+		id, err := pBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		p.ID = int(id)
+
+		if err := putJSON(pBucket, itob(p.ID), p); err != nil {
+			return err
+		}
+		return pBucket.Put(currentPollKey, itob(p.ID))
+	})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	return p, nil
+}
+
+func (s *claudineService) CurrentPoll(ctx context.Context, channel string) (Poll, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var p Poll
+	err := s.store.View(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pollsBucket, false)
+		if err != nil {
+			return err
+		}
+		if pBucket == nil {
+			return ErrNotFound
+		}
+
+		p, err = latestPoll(pBucket)
+		return err
+	})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	return p, nil
+}
+
+func (s *claudineService) GetPoll(ctx context.Context, channel string, id int) (Poll, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var p Poll
+	err := s.store.View(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pollsBucket, false)
+		if err != nil {
+			return err
+		}
+		if pBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(pBucket, itob(id), &p)
+	})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	return p, nil
+}
+
+func (s *claudineService) ListPoll(ctx context.Context, channel string) ([]Poll, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Poll
+	err := s.store.View(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pollsBucket, false)
+		if err != nil || pBucket == nil {
+			return err
+		}
+
+		return pBucket.ForEach(func(id, raw []byte) error {
+			if bytes.Equal(id, currentPollKey) {
+				return nil
+			}
+
+			var p Poll
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return err
+			}
+			list = append(list, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return []Poll{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) VotePoll(ctx context.Context, channel string, userID string, option int) (Poll, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var p Poll
+	err := s.store.Update(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pollsBucket, false)
+		if err != nil {
+			return err
+		}
+		if pBucket == nil {
+			return ErrNotFound
+		}
+
+		p, err = latestPoll(pBucket)
+		if err != nil {
+			return err
+		}
+		// Late votes don't count even if the poll hasn't been closed yet
+		if !p.Open || time.Now().After(p.EndsAt) {
+			return ErrNotFound
+		}
+		if option < 0 || option >= len(p.Options) {
+			return ErrInvalidArgument
+		}
+
+		p.Votes[userID] = option
+		p.tally()
+		return putJSON(pBucket, itob(p.ID), p)
+	})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	return p, nil
+}
+
+func (s *claudineService) ClosePoll(ctx context.Context, channel string, id int) (Poll, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var p Poll
+	err := s.store.Update(func(tx Tx) error {
+		pBucket, err := getChannelSubBucket(tx, channel, pollsBucket, false)
+		if err != nil {
+			return err
+		}
+		if pBucket == nil {
+			return ErrNotFound
+		}
+
+		if err := getJSON(pBucket, itob(id), &p); err != nil {
+			return err
+		}
+		if !p.Open {
+			return nil
+		}
+
+		p.Open = false
+		p.ClosedAt = time.Now().UTC()
+		return putJSON(pBucket, itob(id), p)
+	})
+	if err != nil {
+		return Poll{}, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,109 @@
+package claudine_bot
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPollTally(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		votes   map[string]int
+		want    []int
+	}{
+		{"NoVotes", []string{"yes", "no"}, nil, []int{0, 0}},
+		{"OneEach", []string{"yes", "no"}, map[string]int{"1": 0, "2": 1}, []int{1, 1}},
+		{"Several", []string{"a", "b", "c"}, map[string]int{"1": 2, "2": 2, "3": 0, "4": 2}, []int{1, 0, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Poll{Options: test.options, Votes: test.votes, Tally: []int{9, 9, 9, 9}}
+			p.tally()
+			if !reflect.DeepEqual(p.Tally, test.want) {
+				t.Fatalf("tally() = %v, want %v", p.Tally, test.want)
+			}
+		})
+	}
+}
+
+func TestPollWinners(t *testing.T) {
+	tests := []struct {
+		name  string
+		tally []int
+		want  []int
+	}{
+		{"NoOptions", nil, nil},
+		{"NoVotes", []int{0, 0, 0}, nil},
+		{"OneWinner", []int{1, 4, 2}, []int{1}},
+		{"Tie", []int{3, 1, 3}, []int{0, 2}},
+		{"EveryoneTied", []int{2, 2}, []int{0, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (Poll{Tally: test.tally}).Winners(); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Winners() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLatestPoll(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int
+		current int
+		want    int
+		err     error
+	}{
+		{"NoPolls", nil, 0, 0, ErrNotFound},
+		{"Current", []int{1, 2, 3}, 2, 2, nil},
+		// Polls started before the current poll was kept
+		{"NoCurrent", []int{1, 2, 3}, 0, 3, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "claudine.sqlite"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+
+			err = store.Update(func(tx Tx) error {
+				b, err := tx.CreateBucketIfNotExists(pollsBucket)
+				if err != nil {
+					return err
+				}
+				for _, id := range test.ids {
+					if err := putJSON(b, itob(id), Poll{ID: id}); err != nil {
+						return err
+					}
+				}
+				if test.current != 0 {
+					return b.Put(currentPollKey, itob(test.current))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("write polls: %v", err)
+			}
+
+			err = store.View(func(tx Tx) error {
+				p, err := latestPoll(tx.Bucket(pollsBucket))
+				if err != test.err {
+					t.Fatalf("latestPoll() error = %v, want %v", err, test.err)
+				}
+				if p.ID != test.want {
+					t.Fatalf("latestPoll() = poll %d, want poll %d", p.ID, test.want)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("view: %v", err)
+			}
+		})
+	}
+}
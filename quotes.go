@@ -0,0 +1,177 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+var quotesBucket = []byte("quotes")
+
+// Quote is a numbered quote saved in a channel.
+type Quote struct {
+	ID        int       `json:"id"`
+	Text      string    `json:"text"`
+	QuotedBy  string    `json:"quoted_by"`
+	Game      string    `json:"game"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// itob encodes an id as big endian so keys sort numerically.
+func itob(id int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func (s *claudineService) NewQuote(ctx context.Context, channel string, q Quote) (Quote, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if strings.TrimSpace(q.Text) == "" {
+		return Quote{}, ErrInvalidArgument
+	}
+	if q.CreatedAt.IsZero() {
+		q.CreatedAt = time.Now().UTC()
+	}
+
+	err := s.store.Update(func(tx Tx) error {
+		qBucket, err := getChannelSubBucket(tx, channel, quotesBucket, true)
+		if err != nil {
+			return err
+		}
+
+		id, err := qBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		q.ID = int(id)
+
+		return putJSON(qBucket, itob(q.ID), q)
+	})
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return q, nil
+}
+
+func (s *claudineService) GetQuote(ctx context.Context, channel string, id int) (Quote, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var q Quote
+	err := s.store.View(func(tx Tx) error {
+		qBucket, err := getChannelSubBucket(tx, channel, quotesBucket, false)
+		if err != nil {
+			return err
+		}
+		if qBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(qBucket, itob(id), &q)
+	})
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return q, nil
+}
+
+func (s *claudineService) ListQuote(ctx context.Context, channel string) ([]Quote, error) {
+	return s.filterQuotes(channel, func(q Quote) bool {
+		return true
+	})
+}
+
+func (s *claudineService) SearchQuote(ctx context.Context, channel string, text string) ([]Quote, error) {
+	text = strings.ToLower(text)
+	return s.filterQuotes(channel, func(q Quote) bool {
+		return strings.Contains(strings.ToLower(q.Text), text)
+	})
+}
+
+// filterQuotes returns the quotes in a channel that match, in id order.
+func (s *claudineService) filterQuotes(channel string, match func(q Quote) bool) ([]Quote, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Quote
+	err := s.store.View(func(tx Tx) error {
+		qBucket, err := getChannelSubBucket(tx, channel, quotesBucket, false)
+		if err != nil || qBucket == nil {
+			return err
+		}
+
+		return qBucket.ForEach(func(id, raw []byte) error {
+			var q Quote
+			if err := json.Unmarshal(raw, &q); err != nil {
+				return err
+			}
+			if match(q) {
+				list = append(list, q)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return []Quote{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) UpdateQuote(ctx context.Context, channel string, id int, text string) (Quote, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if strings.TrimSpace(text) == "" {
+		return Quote{}, ErrInvalidArgument
+	}
+
+	var q Quote
+	err := s.store.Update(func(tx Tx) error {
+		qBucket, err := getChannelSubBucket(tx, channel, quotesBucket, false)
+		if err != nil {
+			return err
+		}
+		if qBucket == nil {
+			return ErrNotFound
+		}
+
+		if err := getJSON(qBucket, itob(id), &q); err != nil {
+			return err
+		}
+
+		q.Text = text
+		return putJSON(qBucket, itob(id), q)
+	})
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return q, nil
+}
+
+func (s *claudineService) DeleteQuote(ctx context.Context, channel string, id int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		qBucket, err := getChannelSubBucket(tx, channel, quotesBucket, false)
+		if err != nil {
+			return err
+		}
+		if qBucket == nil {
+			return ErrNotFound
+		}
+
+		if qBucket.Get(itob(id)) == nil {
+			return ErrNotFound
+		}
+		return qBucket.Delete(itob(id))
+	})
+}
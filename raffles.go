@@ -0,0 +1,343 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var rafflesBucket = []byte("raffles")
+
+// Raffle is a giveaway that viewers enter by typing its keyword in chat.
+type Raffle struct {
+	ID      int    `json:"id"`
+	Keyword string `json:"keyword"`
+	// Cost is the number of points taken to enter.
+	Cost int `json:"cost"`
+	// SubWeight is the number of entries subscribers get, 0 counts as 1.
+	SubWeight int          `json:"sub_weight"`
+	Open      bool         `json:"open"`
+	Entrants  []Entrant    `json:"entrants"`
+	Draws     []RaffleDraw `json:"draws"`
+	OpenedAt  time.Time    `json:"opened_at"`
+	ClosedAt  time.Time    `json:"closed_at"`
+}
+
+// Entrant is a user entered into a raffle with their number of entries.
+type Entrant struct {
+	User   string `json:"user"`
+	Weight int    `json:"weight"`
+}
+
+// RaffleDraw records the winners of a draw and the seed that picked them, so
+// anyone can repeat the draw from the entrants.
+type RaffleDraw struct {
+	Seed    int64     `json:"seed"`
+	Winners []string  `json:"winners"`
+	DrawnAt time.Time `json:"drawn_at"`
+}
+
+// Winners returns everyone who has won the raffle so far.
+func (r Raffle) Winners() []string {
+	var winners []string
+	for _, draw := range r.Draws {
+		winners = append(winners, draw.Winners...)
+	}
+	return winners
+}
+
+// draw picks up to count winners from the entrants that haven't won yet,
+// weighted by their entries. The same seed always picks the same winners.
+func (r Raffle) draw(count int, seed int64) []string {
+	won := make(map[string]bool)
+	for _, winner := range r.Winners() {
+		won[winner] = true
+	}
+
+	var pool []Entrant
+	for _, e := range r.Entrants {
+		if !won[e.User] {
+			pool = append(pool, e)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var winners []string
+	for len(winners) < count && len(pool) > 0 {
+		total := 0
+		for _, e := range pool {
+			total += e.Weight
+		}
+
+		n := rng.Intn(total)
+		for i, e := range pool {
+			if n < e.Weight {
+				winners = append(winners, e.User)
+				pool = append(pool[:i], pool[i+1:]...)
+				break
+			}
+			n -= e.Weight
+		}
+	}
+	return winners
+}
+
+// latestRaffle reads the most recently opened raffle.
+func latestRaffle(b Bucket) (Raffle, error) {
+	var r Raffle
+	found := false
+	err := b.ForEach(func(id, raw []byte) error {
+		found = true
+		return json.Unmarshal(raw, &r)
+	})
+	if err != nil {
+		return Raffle{}, err
+	}
+	if !found {
+		return Raffle{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *claudineService) OpenRaffle(ctx context.Context, channel string, r Raffle) (Raffle, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r.Keyword = strings.ToLower(strings.TrimSpace(r.Keyword))
+	if r.Keyword == "" || strings.ContainsAny(r.Keyword, " \t") || r.Cost < 0 || r.SubWeight < 0 {
+		return Raffle{}, ErrInvalidArgument
+	}
+	r.Open = true
+	r.Entrants = []Entrant{}
+	r.Draws = []RaffleDraw{}
+	r.OpenedAt = time.Now().UTC()
+	r.ClosedAt = time.Time{}
+
+	err := s.store.Update(func(tx Tx) error {
+		rBucket, err := getChannelSubBucket(tx, channel, rafflesBucket, true)
+		if err != nil {
+			return err
+		}
+
+		// Only one raffle can run at a time
+		latest, err := latestRaffle(rBucket)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if latest.Open {
+			return ErrAlreadyExist
+		}
+
+		id, err := rBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = int(id)
+
+		return putJSON(rBucket, itob(r.ID), r)
+	})
+	if err != nil {
+		return Raffle{}, err
+	}
+
+	return r, nil
+}
+
+func (s *claudineService) CurrentRaffle(ctx context.Context, channel string) (Raffle, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var r Raffle
+	err := s.store.View(func(tx Tx) error {
+		rBucket, err := getChannelSubBucket(tx, channel, rafflesBucket, false)
+		if err != nil {
+			return err
+		}
+		if rBucket == nil {
+			return ErrNotFound
+		}
+
+		r, err = latestRaffle(rBucket)
+		return err
+	})
+	if err != nil {
+		return Raffle{}, err
+	}
+
+	return r, nil
+}
+
+func (s *claudineService) GetRaffle(ctx context.Context, channel string, id int) (Raffle, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var r Raffle
+	err := s.store.View(func(tx Tx) error {
+		rBucket, err := getChannelSubBucket(tx, channel, rafflesBucket, false)
+		if err != nil {
+			return err
+		}
+		if rBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(rBucket, itob(id), &r)
+	})
+	if err != nil {
+		return Raffle{}, err
+	}
+
+	return r, nil
+}
+
+func (s *claudineService) ListRaffle(ctx context.Context, channel string) ([]Raffle, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Raffle
+	err := s.store.View(func(tx Tx) error {
+		rBucket, err := getChannelSubBucket(tx, channel, rafflesBucket, false)
+		if err != nil || rBucket == nil {
+			return err
+		}
+
+		return rBucket.ForEach(func(id, raw []byte) error {
+			var r Raffle
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return err
+			}
+			list = append(list, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return []Raffle{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) EnterRaffle(ctx context.Context, channel string, user string, subscriber bool) (Raffle, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	user = strings.ToLower(user)
+	var r Raffle
+	err := s.store.Update(func(tx Tx) error {
+		rBucket, err := getChannelSubBucket(tx, channel, rafflesBucket, false)
+		if err != nil {
+			return err
+		}
+		if rBucket == nil {
+			return ErrNotFound
+		}
+
+		r, err = latestRaffle(rBucket)
+		if err != nil {
+			return err
+		}
+		if !r.Open {
+			return ErrNotFound
+		}
+		for _, e := range r.Entrants {
+			if e.User == user {
+				return ErrAlreadyExist
+			}
+		}
+
+		// Take the entry cost in the same transaction so nobody pays without entering
+		if r.Cost > 0 {
+			pBucket, err := getChannelSubBucket(tx, channel, pointsBucket, true)
+			if err != nil {
+				return err
+			}
+			p, err := getBalance(pBucket, user)
+			if err != nil {
+				return err
+			}
+			if p.Balance < r.Cost {
+				return ErrInsufficientPoints
+			}
+			p.Balance -= r.Cost
+			if err := putJSON(pBucket, []byte(user), p); err != nil {
+				return err
+			}
+		}
+
+		weight := 1
+		if subscriber && r.SubWeight > 1 {
+			weight = r.SubWeight
+		}
+		r.Entrants = append(r.Entrants, Entrant{User: user, Weight: weight})
+
+		return putJSON(rBucket, itob(r.ID), r)
+	})
+	if err != nil {
+		return Raffle{}, err
+	}
+
+	return r, nil
+}
+
+// updateRaffle applies fn to a raffle and saves the result.
+func (s *claudineService) updateRaffle(channel string, id int, fn func(r *Raffle)) (Raffle, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var r Raffle
+	err := s.store.Update(func(tx Tx) error {
+		rBucket, err := getChannelSubBucket(tx, channel, rafflesBucket, false)
+		if err != nil {
+			return err
+		}
+		if rBucket == nil {
+			return ErrNotFound
+		}
+
+		if err := getJSON(rBucket, itob(id), &r); err != nil {
+			return err
+		}
+
+		fn(&r)
+		return putJSON(rBucket, itob(id), r)
+	})
+	if err != nil {
+		return Raffle{}, err
+	}
+
+	return r, nil
+}
+
+func (s *claudineService) CloseRaffle(ctx context.Context, channel string, id int) (Raffle, error) {
+	return s.updateRaffle(channel, id, func(r *Raffle) {
+		if r.Open {
+			r.Open = false
+			r.ClosedAt = time.Now().UTC()
+		}
+	})
+}
+
+func (s *claudineService) DrawRaffle(ctx context.Context, channel string, id int, count int, seed int64) (Raffle, error) {
+	if count < 1 {
+		return Raffle{}, ErrInvalidArgument
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return s.updateRaffle(channel, id, func(r *Raffle) {
+		// Entries stop once winners are drawn
+		if r.Open {
+			r.Open = false
+			r.ClosedAt = time.Now().UTC()
+		}
+
+		r.Draws = append(r.Draws, RaffleDraw{
+			Seed:    seed,
+			Winners: r.draw(count, seed),
+			DrawnAt: time.Now().UTC(),
+		})
+	})
+}
@@ -0,0 +1,111 @@
+package claudine_bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRaffleDraw(t *testing.T) {
+	entrants := []Entrant{
+		{User: "alice", Weight: 1},
+		{User: "bob", Weight: 3},
+		{User: "carol", Weight: 1},
+		{User: "dave", Weight: 2},
+	}
+
+	tests := []struct {
+		name   string
+		raffle Raffle
+		count  int
+		// want is how many winners are drawn, none of them from not.
+		want int
+		not  []string
+	}{
+		{"One", Raffle{Entrants: entrants}, 1, 1, nil},
+		{"Several", Raffle{Entrants: entrants}, 3, 3, nil},
+		{"MoreThanEntrants", Raffle{Entrants: entrants}, 10, 4, nil},
+		{"None", Raffle{Entrants: entrants}, 0, 0, nil},
+		{"NoEntrants", Raffle{}, 2, 0, nil},
+		{"SkipsWinners", Raffle{
+			Entrants: entrants,
+			Draws:    []RaffleDraw{{Winners: []string{"bob"}}, {Winners: []string{"dave"}}},
+		}, 5, 2, []string{"bob", "dave"}},
+		{"EveryoneWon", Raffle{
+			Entrants: entrants[:1],
+			Draws:    []RaffleDraw{{Winners: []string{"alice"}}},
+		}, 1, 0, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				winners := test.raffle.draw(test.count, seed)
+				if len(winners) != test.want {
+					t.Fatalf("draw(%d, %d) = %v, want %d winners", test.count, seed, winners, test.want)
+				}
+
+				seen := make(map[string]bool)
+				for _, w := range winners {
+					if seen[w] {
+						t.Fatalf("draw(%d, %d) = %v, %s won twice", test.count, seed, winners, w)
+					}
+					seen[w] = true
+				}
+				for _, w := range test.not {
+					if seen[w] {
+						t.Fatalf("draw(%d, %d) = %v, %s had already won", test.count, seed, winners, w)
+					}
+				}
+
+				// The seed alone decides the winners
+				if again := test.raffle.draw(test.count, seed); !reflect.DeepEqual(again, winners) {
+					t.Fatalf("draw(%d, %d) = %v then %v", test.count, seed, winners, again)
+				}
+			}
+		})
+	}
+}
+
+func TestRaffleDrawWeights(t *testing.T) {
+	r := Raffle{Entrants: []Entrant{
+		{User: "sub", Weight: 9},
+		{User: "viewer", Weight: 1},
+	}}
+
+	wins := 0
+	const draws = 2000
+	for seed := int64(0); seed < draws; seed++ {
+		if r.draw(1, seed)[0] == "sub" {
+			wins++
+		}
+	}
+
+	// 9 of every 10 entries are the sub's
+	if wins < draws*85/100 || wins > draws*95/100 {
+		t.Fatalf("sub won %d of %d draws, want about 90%%", wins, draws)
+	}
+}
+
+func TestRaffleWinners(t *testing.T) {
+	tests := []struct {
+		name  string
+		draws []RaffleDraw
+		want  []string
+	}{
+		{"NoDraws", nil, nil},
+		{"OneDraw", []RaffleDraw{{Winners: []string{"alice", "bob"}}}, []string{"alice", "bob"}},
+		{"InDrawOrder", []RaffleDraw{
+			{Winners: []string{"carol"}},
+			{Winners: nil},
+			{Winners: []string{"alice", "bob"}},
+		}, []string{"carol", "alice", "bob"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (Raffle{Draws: test.draws}).Winners(); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("Winners() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
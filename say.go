@@ -0,0 +1,137 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Twitch lets an account send 20 messages every 30 seconds in a channel it
+// doesn't moderate.
+const (
+	sayLimit  = 20
+	sayWindow = 30 * time.Second
+)
+
+var (
+	ErrRateLimited = errors.New("rate limited")
+	// ErrNotConnected is returned by a SayFunc when the bot isn't in chat.
+	ErrNotConnected = errors.New("not connected to IRC")
+)
+
+// SayFunc sends a message to a channel's chat, rendering it as a command
+// template first if render is set. It returns the text that was sent.
+type SayFunc func(ctx context.Context, channel string, message string, render bool) (string, error)
+
+type sayRequest struct {
+	// Message is sent as is.
+	Message string `json:"message"`
+	// Template is rendered like a command's action and then sent.
+	Template string `json:"template"`
+}
+
+type sayResponse struct {
+	Message string `json:"message"`
+}
+
+// sayLimiter keeps the messages sent per channel within Twitch's limits.
+type sayLimiter struct {
+	mtx  sync.Mutex
+	sent map[string][]time.Time
+}
+
+// allow reports whether the channel is under the limit, and otherwise returns
+// how long until the next message can be sent.
+func (l *sayLimiter) allow(channel string, now time.Time) (time.Duration, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	// Drop messages that have left the window
+	sent := l.sent[channel]
+	for len(sent) > 0 && now.Sub(sent[0]) >= sayWindow {
+		sent = sent[1:]
+	}
+	l.sent[channel] = sent
+
+	if len(sent) >= sayLimit {
+		return sent[0].Add(sayWindow).Sub(now), false
+	}
+	return 0, true
+}
+
+// record counts a message sent to the channel against its limit.
+func (l *sayLimiter) record(channel string, now time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.sent[channel] = append(l.sent[channel], now)
+}
+
+// MakeSayHandler lets other services post in a channel's chat as the bot:
+//
+//	POST /api/v1/channels/{channel}/say
+//
+// The body has either a message or a template, and the request needs the
+// admin token.
+func MakeSayHandler(s Service, say SayFunc, adminToken string) http.Handler {
+	limiter := &sayLimiter{sent: make(map[string][]time.Time)}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, adminToken) {
+			encodeError(r.Context(), ErrUnauthorized, w)
+			return
+		}
+
+		channel, ok := mux.Vars(r)["channel"]
+		if !ok {
+			encodeError(r.Context(), ErrBadRouting, w)
+			return
+		}
+		// Channel names aren't case sensitive, so neither is their limit
+		key := strings.ToLower(channel)
+
+		var req sayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Message == "") == (req.Template == "") {
+			encodeError(r.Context(), ErrInvalidArgument, w)
+			return
+		}
+
+		// Only channels the bot is in can be posted to
+		if _, err := s.GetSettings(r.Context(), channel); err != nil {
+			encodeError(r.Context(), err, w)
+			return
+		}
+
+		if wait, ok := limiter.allow(key, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			encodeError(r.Context(), ErrRateLimited, w)
+			return
+		}
+
+		message, render := req.Message, false
+		if req.Template != "" {
+			message, render = req.Template, true
+		}
+		sent, err := say(r.Context(), channel, message, render)
+		if err != nil {
+			encodeError(r.Context(), err, w)
+			return
+		}
+		// Requests that didn't reach chat don't count towards the limit
+		limiter.record(key, time.Now())
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(sayResponse{Message: sent})
+	})
+}
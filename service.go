@@ -3,10 +3,14 @@ package claudine_bot
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
-	bolt "github.com/etcd-io/bbolt"
+	"github.com/go-kit/kit/log"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -31,6 +35,110 @@ type Service interface {
 	GetRepeatCommand(ctx context.Context, channel string, trigger string) (RepeatCommand, error)
 	ListRepeatCommand(ctx context.Context, channel string) ([]RepeatCommand, error)
 	DeleteRepeatCommand(ctx context.Context, channel string, trigger string) error
+
+	// Settings functions
+	GetSettings(ctx context.Context, channel string) (ChannelSettings, error)
+	// UpdateSettings applies the JSON patch over the channel's current settings,
+	// so fields it leaves out keep their value.
+	UpdateSettings(ctx context.Context, channel string, patch json.RawMessage) (ChannelSettings, error)
+
+	// Counter functions
+	NewCounter(ctx context.Context, channel string, name string) (Counter, error)
+	GetCounter(ctx context.Context, channel string, name string) (Counter, error)
+	ListCounter(ctx context.Context, channel string) ([]Counter, error)
+	// IncrementCounter adds delta to a counter, a negative delta decrements it.
+	IncrementCounter(ctx context.Context, channel string, name string, delta int) (Counter, error)
+	SetCounter(ctx context.Context, channel string, name string, value int) (Counter, error)
+	ResetCounter(ctx context.Context, channel string, name string) (Counter, error)
+	DeleteCounter(ctx context.Context, channel string, name string) error
+
+	// Quote functions
+	NewQuote(ctx context.Context, channel string, q Quote) (Quote, error)
+	GetQuote(ctx context.Context, channel string, id int) (Quote, error)
+	ListQuote(ctx context.Context, channel string) ([]Quote, error)
+	SearchQuote(ctx context.Context, channel string, text string) ([]Quote, error)
+	UpdateQuote(ctx context.Context, channel string, id int, text string) (Quote, error)
+	DeleteQuote(ctx context.Context, channel string, id int) error
+
+	// Points functions
+	GetPoints(ctx context.Context, channel string, user string) (Points, error)
+	// AddPoints adds amount to each user's balance, balances don't go below zero.
+	AddPoints(ctx context.Context, channel string, users []string, amount int) error
+	GivePoints(ctx context.Context, channel string, from string, to string, amount int) error
+	// ListPoints returns the highest balances first, a limit of 0 returns all.
+	ListPoints(ctx context.Context, channel string, limit int) ([]Points, error)
+
+	// Raffle functions
+	OpenRaffle(ctx context.Context, channel string, r Raffle) (Raffle, error)
+	// CurrentRaffle returns the most recently opened raffle.
+	CurrentRaffle(ctx context.Context, channel string) (Raffle, error)
+	GetRaffle(ctx context.Context, channel string, id int) (Raffle, error)
+	ListRaffle(ctx context.Context, channel string) ([]Raffle, error)
+	// EnterRaffle enters a user into the open raffle, paying its cost in points.
+	EnterRaffle(ctx context.Context, channel string, user string, subscriber bool) (Raffle, error)
+	CloseRaffle(ctx context.Context, channel string, id int) (Raffle, error)
+	// DrawRaffle closes the raffle and draws count winners. A seed of 0 picks one.
+	DrawRaffle(ctx context.Context, channel string, id int, count int, seed int64) (Raffle, error)
+
+	// Poll functions
+	NewPoll(ctx context.Context, channel string, p Poll) (Poll, error)
+	// CurrentPoll returns the most recently started poll.
+	CurrentPoll(ctx context.Context, channel string) (Poll, error)
+	GetPoll(ctx context.Context, channel string, id int) (Poll, error)
+	ListPoll(ctx context.Context, channel string) ([]Poll, error)
+	// VotePoll sets a user's vote in the open poll, replacing any earlier vote.
+	VotePoll(ctx context.Context, channel string, userID string, option int) (Poll, error)
+	ClosePoll(ctx context.Context, channel string, id int) (Poll, error)
+
+	// Song request functions
+	// RequestSong queues a song, checking it against the channel's limits.
+	RequestSong(ctx context.Context, channel string, song Song) (Song, error)
+	ListSong(ctx context.Context, channel string) ([]Song, error)
+	CurrentSong(ctx context.Context, channel string) (Song, error)
+	// NextSong takes the next song off the queue and makes it the current song.
+	NextSong(ctx context.Context, channel string) (Song, error)
+	DeleteSong(ctx context.Context, channel string, id int) error
+
+	// Moderation functions
+	LogModAction(ctx context.Context, channel string, a ModAction) (ModAction, error)
+	// ListModAction returns the matching actions, newest first.
+	ListModAction(ctx context.Context, channel string, q ModActionQuery) ([]ModAction, error)
+
+	// Event response functions
+	SetEventResponse(ctx context.Context, channel string, r EventResponse) (EventResponse, error)
+	GetEventResponse(ctx context.Context, channel string, event string) (EventResponse, error)
+	ListEventResponse(ctx context.Context, channel string) ([]EventResponse, error)
+	DeleteEventResponse(ctx context.Context, channel string, event string) error
+
+	// Broadcaster token functions
+	SetBroadcasterToken(ctx context.Context, channel string, token string) error
+	GetBroadcasterToken(ctx context.Context, channel string) (string, error)
+
+	// Bot account functions
+	SetBotAccount(ctx context.Context, a BotAccount) (BotAccount, error)
+	GetBotAccount(ctx context.Context, name string) (BotAccount, error)
+	ListBotAccount(ctx context.Context) ([]BotAccount, error)
+	DeleteBotAccount(ctx context.Context, name string) error
+
+	// Webhook functions
+	AddWebhook(ctx context.Context, channel string, w Webhook) (Webhook, error)
+	GetWebhook(ctx context.Context, channel string, id int) (Webhook, error)
+	ListWebhook(ctx context.Context, channel string) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, channel string, id int) error
+	ListWebhookDeadLetter(ctx context.Context, channel string) ([]WebhookDeadLetter, error)
+	DeleteWebhookDeadLetter(ctx context.Context, channel string, id int) error
+
+	// Webhook delivery queue functions. The queue is shared by every channel.
+	QueueWebhookDelivery(ctx context.Context, d WebhookDelivery) (WebhookDelivery, error)
+	// DueWebhookDelivery returns up to limit deliveries due by now, oldest first.
+	DueWebhookDelivery(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, d WebhookDelivery) error
+	DeleteWebhookDelivery(ctx context.Context, id int) error
+	// DeadLetterWebhookDelivery takes a delivery off the queue and keeps it
+	// as a dead letter of its channel.
+	DeadLetterWebhookDelivery(ctx context.Context, d WebhookDelivery) (WebhookDeadLetter, error)
+	LogWebhookAttempt(ctx context.Context, channel string, a WebhookAttempt) (WebhookAttempt, error)
+	ListWebhookAttempt(ctx context.Context, channel string, q WebhookAttemptQuery) ([]WebhookAttempt, error)
 }
 
 type Command struct {
@@ -45,20 +153,243 @@ type RepeatCommand struct {
 
 type Channel string
 
+const (
+	ResponseModeSay   = "say"
+	ResponseModeReply = "reply"
+)
+
+// ChannelSettings controls how the bot behaves in a single channel.
+type ChannelSettings struct {
+	Prefix   string `json:"prefix"`
+	Language string `json:"language"`
+	Timezone string `json:"timezone"`
+
+	// Builtins toggles built-in commands such as uptime. Missing entries are enabled.
+	Builtins map[string]bool `json:"builtins"`
+
+	// Default cooldowns in seconds, applied to custom commands.
+	GlobalCooldown int `json:"global_cooldown"`
+	UserCooldown   int `json:"user_cooldown"`
+
+	// ResponseMode is either ResponseModeSay or ResponseModeReply.
+	ResponseMode string `json:"response_mode"`
+
+	// PointsPerMinute is awarded to viewers while the channel is live. Disable
+	// the points builtin to stop accruing.
+	PointsPerMinute int `json:"points_per_minute"`
+
+	SongRequests SongRequestSettings `json:"song_requests"`
+
+	Filters FilterSettings `json:"filters"`
+
+	// RaidShoutout gives raiders a shoutout with the game they last played.
+	RaidShoutout bool `json:"raid_shoutout"`
+
+	// ShoutoutTemplate is posted by !so and raid shoutouts. It can use
+	// {{.DisplayName}}, {{.User}}, {{.Game}} and {{.URL}}.
+	ShoutoutTemplate string `json:"shoutout_template"`
+	// ShoutoutCooldown in seconds before the same user can be shouted out again.
+	ShoutoutCooldown int `json:"shoutout_cooldown"`
+
+	// BotAccount is the bot account that chats in the channel, the default
+	// one when empty.
+	BotAccount string `json:"bot_account"`
+}
+
+// SongRequestSettings limits what viewers can add to the song queue.
+type SongRequestSettings struct {
+	// UserLimit is how many songs each user can have queued, 0 for no limit.
+	UserLimit int `json:"user_limit"`
+	// MaxLength in seconds, only checked for songs with a known length. 0 for
+	// no limit.
+	MaxLength int `json:"max_length"`
+	// Blocked words, video IDs or URLs.
+	Blocked []string `json:"blocked"`
+}
+
+// FilterSettings controls which chat messages are moderated. Each filter is off
+// at its zero value. Mods and the broadcaster are never filtered.
+type FilterSettings struct {
+	Links          bool     `json:"links"`
+	AllowedDomains []string `json:"allowed_domains"`
+	// PermitDuration is how many seconds !permit allows a user to post links.
+	PermitDuration int `json:"permit_duration"`
+
+	// CapsRatio is the highest share of capital letters allowed in messages
+	// of at least CapsMinLength letters.
+	CapsRatio     float64 `json:"caps_ratio"`
+	CapsMinLength int     `json:"caps_min_length"`
+
+	// SymbolRatio is the highest share of symbols allowed in messages of at
+	// least SymbolMinLength characters.
+	SymbolRatio     float64 `json:"symbol_ratio"`
+	SymbolMinLength int     `json:"symbol_min_length"`
+
+	MaxEmotes        int `json:"max_emotes"`
+	MaxRepeatedChars int `json:"max_repeated_chars"`
+
+	// BannedPhrases match case insensitively, or as a regular expression when
+	// wrapped in slashes such as /f+ree gold/.
+	BannedPhrases []string `json:"banned_phrases"`
+
+	// Penalties are timeouts in seconds for an offender's first, second, etc.
+	// offence. 0 only deletes the message.
+	Penalties []int `json:"penalties"`
+	// Exempt roles, such as subscriber or vip.
+	Exempt []string `json:"exempt"`
+}
+
+func (f FilterSettings) validate() error {
+	if f.CapsRatio < 0 || f.CapsRatio > 1 || f.SymbolRatio < 0 || f.SymbolRatio > 1 {
+		return ErrInvalidSettings
+	}
+	if f.PermitDuration < 0 || f.CapsMinLength < 0 || f.SymbolMinLength < 0 || f.MaxEmotes < 0 || f.MaxRepeatedChars < 0 {
+		return ErrInvalidSettings
+	}
+	for _, penalty := range f.Penalties {
+		if penalty < 0 {
+			return ErrInvalidSettings
+		}
+	}
+	for _, phrase := range f.BannedPhrases {
+		if _, err := BannedPhraseRegexp(phrase); err != nil {
+			return ErrInvalidSettings
+		}
+	}
+	return nil
+}
+
+// BannedPhraseRegexp compiles a banned phrase. Phrases wrapped in slashes are
+// regular expressions, anything else matches literally. Both ignore case.
+func BannedPhraseRegexp(phrase string) (*regexp.Regexp, error) {
+	if len(phrase) > 2 && strings.HasPrefix(phrase, "/") && strings.HasSuffix(phrase, "/") {
+		return regexp.Compile("(?i)" + phrase[1:len(phrase)-1])
+	}
+	return regexp.Compile("(?i)" + regexp.QuoteMeta(phrase))
+}
+
+// DefaultSettings are used for channels that haven't saved any settings.
+var DefaultSettings = ChannelSettings{
+	Prefix:           "!",
+	Language:         "en",
+	Timezone:         "UTC",
+	ResponseMode:     ResponseModeSay,
+	PointsPerMinute:  1,
+	ShoutoutTemplate: "Go check out {{.DisplayName}} at {{.URL}}{{if .Game}}, they were last playing {{.Game}}{{end}}!",
+	ShoutoutCooldown: 60,
+	SongRequests: SongRequestSettings{
+		UserLimit: 3,
+		MaxLength: 600,
+	},
+	Filters: FilterSettings{
+		PermitDuration:  60,
+		CapsMinLength:   10,
+		SymbolMinLength: 10,
+		Penalties:       []int{0, 60, 600},
+	},
+}
+
+// BuiltinEnabled reports whether the named built-in command is enabled.
+func (s ChannelSettings) BuiltinEnabled(name string) bool {
+	enabled, ok := s.Builtins[name]
+	return !ok || enabled
+}
+
+func (s ChannelSettings) validate() error {
+	if s.Prefix == "" || strings.ContainsAny(s.Prefix, " \t") {
+		return ErrInvalidSettings
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return ErrInvalidSettings
+	}
+	if s.ResponseMode != ResponseModeSay && s.ResponseMode != ResponseModeReply {
+		return ErrInvalidSettings
+	}
+	if s.GlobalCooldown < 0 || s.UserCooldown < 0 {
+		return ErrInvalidSettings
+	}
+	if s.PointsPerMinute < 0 {
+		return ErrInvalidSettings
+	}
+	if s.ShoutoutCooldown < 0 {
+		return ErrInvalidSettings
+	}
+	if s.SongRequests.UserLimit < 0 || s.SongRequests.MaxLength < 0 {
+		return ErrInvalidSettings
+	}
+	if err := s.Filters.validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// withDefaults fills any empty fields from DefaultSettings.
+func (s ChannelSettings) withDefaults() ChannelSettings {
+	if s.Prefix == "" {
+		s.Prefix = DefaultSettings.Prefix
+	}
+	if s.Language == "" {
+		s.Language = DefaultSettings.Language
+	}
+	if s.Timezone == "" {
+		s.Timezone = DefaultSettings.Timezone
+	}
+	if s.ResponseMode == "" {
+		s.ResponseMode = DefaultSettings.ResponseMode
+	}
+	if s.PointsPerMinute == 0 {
+		s.PointsPerMinute = DefaultSettings.PointsPerMinute
+	}
+	if s.ShoutoutTemplate == "" {
+		s.ShoutoutTemplate = DefaultSettings.ShoutoutTemplate
+	}
+	if s.ShoutoutCooldown == 0 {
+		s.ShoutoutCooldown = DefaultSettings.ShoutoutCooldown
+	}
+	s.Filters = s.Filters.withDefaults()
+	return s
+}
+
+// withDefaults fills the lengths and penalties from DefaultSettings. The
+// filters themselves stay off until they're set.
+func (f FilterSettings) withDefaults() FilterSettings {
+	if f.PermitDuration == 0 {
+		f.PermitDuration = DefaultSettings.Filters.PermitDuration
+	}
+	if f.CapsMinLength == 0 {
+		f.CapsMinLength = DefaultSettings.Filters.CapsMinLength
+	}
+	if f.SymbolMinLength == 0 {
+		f.SymbolMinLength = DefaultSettings.Filters.SymbolMinLength
+	}
+	if f.Penalties == nil {
+		f.Penalties = append([]int(nil), DefaultSettings.Filters.Penalties...)
+	}
+	return f
+}
+
 var (
 	ErrAlreadyExist = errors.New("already exists")
 	ErrNotFound     = errors.New("not found")
 	ErrGeneric      = errors.New("generic server error")
+
+	ErrInvalidSettings = errors.New("invalid settings")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	ErrInsufficientPoints = errors.New("not enough points")
 )
 
 type claudineService struct {
-	mtx          sync.RWMutex
-	db           *bolt.DB
+	mtx    sync.RWMutex
+	store  Store
+	logger log.Logger
 }
 
-func NewClaudineService(db *bolt.DB) Service {
+func NewClaudineService(store Store, logger log.Logger) Service {
 	return &claudineService{
-		db:           db,
+		store:  store,
+		logger: logger,
 	}
 }
 
@@ -68,9 +399,13 @@ func (s *claudineService) NewChannel(ctx context.Context, channel string) (Chann
 	defer s.mtx.Unlock()
 
 	// Create a channel bucket
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		//b := tx.Bucket([]byte(channel))
-		b, err := tx.CreateBucketIfNotExists([]byte(channel))
+	err := s.store.Update(func(tx Tx) error {
+		root, err := tx.CreateBucketIfNotExists(channelsBucket)
+		if err != nil {
+			return err
+		}
+
+		b, err := root.CreateBucketIfNotExists([]byte(channel))
 		if err != nil {
 			return err
 		}
@@ -85,6 +420,7 @@ func (s *claudineService) NewChannel(ctx context.Context, channel string) (Chann
 	})
 
 	if err != nil {
+		s.logger.Log("method", "NewChannel", "channel", channel, "err", err)
 		return "", ErrAlreadyExist
 	}
 
@@ -96,8 +432,17 @@ func (s *claudineService) ListChannel(ctx context.Context) ([]Channel, error) {
 	defer s.mtx.RUnlock()
 
 	var channels []Channel
-	err := s.db.View(func(tx *bolt.Tx) error {
-		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+	err := s.store.View(func(tx Tx) error {
+		root := tx.Bucket(channelsBucket)
+		if root == nil {
+			return nil
+		}
+
+		err := root.ForEach(func(name []byte, v []byte) error {
+			b := root.Bucket(name)
+			if b == nil {
+				return nil
+			}
 			if bytes.Compare(b.Get([]byte("enabled")), TRUE) == 0 {
 				channels = append(channels, Channel(name))
 			}
@@ -115,8 +460,8 @@ func (s *claudineService) DeleteChannel(ctx context.Context, channel string) err
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(channel))
+	err := s.store.Update(func(tx Tx) error {
+		b := getChannelBucket(tx, channel)
 		if b == nil {
 			return ErrNotFound
 		}
@@ -133,21 +478,20 @@ func (s *claudineService) NewCommand(ctx context.Context, channel string, c Comm
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.store.Update(func(tx Tx) error {
 		cBucket, err := GetActiveCommandBucket(tx, channel)
 		if err != nil {
 			return err
 		}
 
 		// Check if command exists
-		command := cBucket.Get([]byte(c.Action))
+		command := cBucket.Get([]byte(c.Trigger))
 		if command != nil {
 			return ErrAlreadyExist
 		}
 
 		// Create command
-		err = cBucket.Put([]byte(c.Trigger), []byte(c.Action))
-		return err
+		return putJSON(cBucket, []byte(c.Trigger), c)
 	})
 	if err != nil {
 		return Command{}, err
@@ -164,19 +508,13 @@ func (s *claudineService) GetCommand(ctx context.Context, channel string, trigge
 		Trigger: trigger,
 	}
 
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.View(func(tx Tx) error {
 		cBucket, err := GetActiveCommandBucket(tx, channel)
 		if err != nil {
 			return err
 		}
 
-		response := cBucket.Get([]byte(trigger))
-		if response == nil {
-			return ErrNotFound
-		}
-
-		c.Action = string(response)
-		return nil
+		return getJSON(cBucket, []byte(trigger), &c)
 	})
 	if err != nil {
 		return Command{}, err
@@ -190,17 +528,18 @@ func (s *claudineService) ListCommand(ctx context.Context, channel string) ([]Co
 	defer s.mtx.RUnlock()
 	var list []Command
 
-	err := s.db.View(func(tx *bolt.Tx) error {
+	err := s.store.View(func(tx Tx) error {
 		cBucket, err := GetActiveCommandBucket(tx, channel)
 		if err != nil {
 			return err
 		}
 
-		err = cBucket.ForEach(func(trigger, action []byte) error {
-			list = append(list, Command{
-				Trigger: string(trigger),
-				Action:  string(action),
-			})
+		err = cBucket.ForEach(func(trigger, raw []byte) error {
+			var c Command
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return err
+			}
+			list = append(list, c)
 			return nil
 		})
 		return err
@@ -220,23 +559,23 @@ func (s *claudineService) UpdateCommand(ctx context.Context, channel string, tri
 		Trigger: trigger,
 	}
 
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.store.Update(func(tx Tx) error {
 		cBucket, err := GetActiveCommandBucket(tx, channel)
 		if err != nil {
 			return err
 		}
 
-		response := cBucket.Get([]byte(trigger))
-		if response == nil {
-			return ErrNotFound
+		if err := getJSON(cBucket, []byte(trigger), &c); err != nil {
+			return err
 		}
 
-		err = cBucket.Put([]byte(trigger), []byte(action))
+		c.Action = action
+		err = putJSON(cBucket, []byte(trigger), c)
 		if err != nil {
+			s.logger.Log("method", "UpdateCommand", "channel", channel, "err", err)
 			return ErrGeneric
 		}
 
-		c.Action = action
 		return nil
 	})
 	if err != nil {
@@ -250,8 +589,11 @@ func (s *claudineService) DeleteCommand(ctx context.Context, channel string, tri
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	err := s.db.Update(func(tx *bolt.Tx) error {
+	err := s.store.Update(func(tx Tx) error {
 		cBucket, err := GetActiveCommandBucket(tx, channel)
+		if err != nil {
+			return err
+		}
 
 		response := cBucket.Get([]byte(trigger))
 		if response == nil {
@@ -260,6 +602,7 @@ func (s *claudineService) DeleteCommand(ctx context.Context, channel string, tri
 
 		err = cBucket.Delete([]byte(trigger))
 		if err != nil {
+			s.logger.Log("method", "DeleteCommand", "channel", channel, "err", err)
 			return ErrGeneric
 		}
 
@@ -273,8 +616,8 @@ func (s *claudineService) NewRepeatCommand(ctx context.Context, channel string,
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		rBucket, err := tx.CreateBucketIfNotExists([]byte("repeat"))
+	err := s.store.Update(func(tx Tx) error {
+		rBucket, err := tx.CreateBucketIfNotExists(repeatBucket)
 		if err != nil {
 			return err
 		}
@@ -312,8 +655,8 @@ func (s *claudineService) GetRepeatCommand(ctx context.Context, channel string,
 	}
 
 
-	err := s.db.View(func(tx *bolt.Tx) error {
-		rBucket := tx.Bucket([]byte("repeat"))
+	err := s.store.View(func(tx Tx) error {
+		rBucket := tx.Bucket(repeatBucket)
 		if rBucket == nil {
 			return ErrNotFound
 		}
@@ -347,8 +690,8 @@ func (s *claudineService) GetRepeatCommand(ctx context.Context, channel string,
 func (s *claudineService) ListRepeatCommand(ctx context.Context, channel string) ([]RepeatCommand, error) {
 	var list []RepeatCommand
 
-	err := s.db.View(func(tx *bolt.Tx) error {
-		rBucket := tx.Bucket([]byte("repeat"))
+	err := s.store.View(func(tx Tx) error {
+		rBucket := tx.Bucket(repeatBucket)
 		if rBucket == nil {
 			return ErrNotFound
 		}
@@ -381,8 +724,8 @@ func (s *claudineService) ListRepeatCommand(ctx context.Context, channel string)
 }
 
 func (s *claudineService) DeleteRepeatCommand(ctx context.Context, channel string, trigger string) error {
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		rBucket := tx.Bucket([]byte("repeat"))
+	err := s.store.Update(func(tx Tx) error {
+		rBucket := tx.Bucket(repeatBucket)
 		if rBucket == nil {
 			return ErrNotFound
 		}
@@ -399,20 +742,159 @@ func (s *claudineService) DeleteRepeatCommand(ctx context.Context, channel strin
 	return  err
 }
 
-func GetActiveCommandBucket(tx *bolt.Tx, channel string) (*bolt.Bucket, error) {
+// Settings Functions
+func (s *claudineService) GetSettings(ctx context.Context, channel string) (ChannelSettings, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var settings ChannelSettings
+	err := s.store.View(func(tx Tx) error {
+		bucket, err := GetActiveChannelBucket(tx, channel)
+		if err != nil {
+			return err
+		}
+
+		settings, err = readSettings(bucket)
+		return err
+	})
+	if err != nil {
+		return ChannelSettings{}, err
+	}
+
+	return settings, nil
+}
+
+// readSettings reads the settings saved in a channel bucket, using the
+// defaults for anything missing.
+func readSettings(bucket Bucket) (ChannelSettings, error) {
+	settings := DefaultSettings
+	// Unmarshalling can write into the backing array of a slice, so don't share it
+	settings.Filters.Penalties = append([]int(nil), DefaultSettings.Filters.Penalties...)
+	raw := bucket.Get([]byte("settings"))
+	if raw == nil {
+		return settings, nil
+	}
+
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return ChannelSettings{}, err
+	}
+	return settings.withDefaults(), nil
+}
+
+func (s *claudineService) UpdateSettings(ctx context.Context, channel string, patch json.RawMessage) (ChannelSettings, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var settings ChannelSettings
+	err := s.store.Update(func(tx Tx) error {
+		bucket, err := GetActiveChannelBucket(tx, channel)
+		if err != nil {
+			return err
+		}
+
+		// Read and write in the same transaction so concurrent updates aren't lost
+		settings, err = readSettings(bucket)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(patch, &settings); err != nil {
+			return ErrInvalidSettings
+		}
+
+		settings = settings.withDefaults()
+		if err := settings.validate(); err != nil {
+			return err
+		}
+
+		settings.BotAccount = botAccountName(settings.BotAccount)
+		if settings.BotAccount != "" {
+			accounts := tx.Bucket(botAccountsBucket)
+			if accounts == nil || accounts.Get([]byte(settings.BotAccount)) == nil {
+				return ErrInvalidSettings
+			}
+		}
+
+		raw, err := json.Marshal(settings)
+		if err != nil {
+			s.logger.Log("method", "UpdateSettings", "channel", channel, "err", err)
+			return ErrGeneric
+		}
+
+		return bucket.Put([]byte("settings"), raw)
+	})
+	if err != nil {
+		return ChannelSettings{}, err
+	}
+
+	return settings, nil
+}
+
+// getChannelBucket returns the bucket for a channel, or nil if it doesn't exist.
+func getChannelBucket(tx Tx, channel string) Bucket {
+	root := tx.Bucket(channelsBucket)
+	if root == nil {
+		return nil
+	}
+	return root.Bucket([]byte(channel))
+}
+
+func GetActiveChannelBucket(tx Tx, channel string) (Bucket, error) {
 	// Get the channel bucket
-	bucket := tx.Bucket([]byte(channel))
+	bucket := getChannelBucket(tx, channel)
 	if bucket == nil {
-		return &bolt.Bucket{}, ErrNotFound
+		return nil, ErrNotFound
 	}
 
 	// Check if account is active
 	active := bucket.Get([]byte("enabled"))
 	if bytes.Compare(active, TRUE) != 0 {
-		return &bolt.Bucket{}, ErrNotFound
+		return nil, ErrNotFound
+	}
+
+	return bucket, nil
+}
+
+// getChannelSubBucket returns the named bucket of an active channel, creating
+// it if needed in a writable transaction. Without create, the bucket is nil
+// when the channel has nothing there yet.
+func getChannelSubBucket(tx Tx, channel string, name []byte, create bool) (Bucket, error) {
+	bucket, err := GetActiveChannelBucket(tx, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	if create {
+		return bucket.CreateBucketIfNotExists(name)
+	}
+	return bucket.Bucket(name), nil
+}
+
+func GetActiveCommandBucket(tx Tx, channel string) (Bucket, error) {
+	bucket, err := GetActiveChannelBucket(tx, channel)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the commands bucket
 	cBucket := bucket.Bucket([]byte("commands"))
 	return cBucket, nil
 }
+
+// putJSON stores v under key as JSON.
+func putJSON(b Bucket, key []byte, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, raw)
+}
+
+// getJSON decodes the JSON stored under key into v, returning ErrNotFound if
+// there isn't anything there.
+func getJSON(b Bucket, key []byte, v interface{}) error {
+	raw := b.Get(key)
+	if raw == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, v)
+}
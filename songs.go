@@ -0,0 +1,339 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	songsBucket = []byte("songs")
+	queueBucket = []byte("queue")
+	currentKey  = []byte("current")
+)
+
+const (
+	SongYouTube    = "youtube"
+	SongSpotify    = "spotify"
+	SongSoundCloud = "soundcloud"
+	// SongSearch is a request by name that a resolver may turn into a link.
+	SongSearch = "search"
+)
+
+var (
+	ErrUnsupportedSong = errors.New("unsupported song link")
+	ErrSongBlocked     = errors.New("song is blocked")
+	ErrSongTooLong     = errors.New("song is too long")
+	ErrSongLimit       = errors.New("too many songs queued")
+)
+
+var (
+	youtubeIDRegexp  = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	spotifyIDRegexp  = regexp.MustCompile(`^[A-Za-z0-9]{22}$`)
+	soundCloudRegexp = regexp.MustCompile(`^/[A-Za-z0-9_-]+/[A-Za-z0-9_-]+/?$`)
+)
+
+// Song is a song requested by a viewer.
+type Song struct {
+	ID       int    `json:"id"`
+	Provider string `json:"provider"`
+	// SongID is the provider's ID for the song, empty for searches.
+	SongID string `json:"song_id"`
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	// Duration in seconds, 0 if unknown.
+	Duration    int       `json:"duration"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// SongResolver looks up a song's title and length, or finds a link for a
+// search. Songs are queued as parsed when there's no resolver.
+type SongResolver interface {
+	Resolve(ctx context.Context, song Song) (Song, error)
+}
+
+// ParseSong recognises YouTube, Spotify and SoundCloud links without fetching
+// them. Anything that isn't a link is treated as a search.
+func ParseSong(request string) (Song, error) {
+	request = strings.TrimSpace(request)
+	if request == "" {
+		return Song{}, ErrInvalidArgument
+	}
+
+	if strings.HasPrefix(request, "spotify:track:") {
+		return spotifySong(strings.TrimPrefix(request, "spotify:track:"))
+	}
+
+	if !strings.Contains(request, "://") {
+		// A single word with a dot is a link missing its scheme
+		if strings.ContainsAny(request, " \t") || !strings.Contains(request, ".") {
+			return Song{Provider: SongSearch, Title: request}, nil
+		}
+		request = "https://" + request
+	}
+
+	u, err := url.Parse(request)
+	if err != nil {
+		return Song{}, ErrUnsupportedSong
+	}
+
+	switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+	case "youtube.com", "m.youtube.com", "music.youtube.com":
+		if u.Path != "/watch" {
+			return Song{}, ErrUnsupportedSong
+		}
+		return youtubeSong(u.Query().Get("v"))
+	case "youtu.be":
+		return youtubeSong(strings.Trim(u.Path, "/"))
+	case "open.spotify.com":
+		if !strings.HasPrefix(u.Path, "/track/") {
+			return Song{}, ErrUnsupportedSong
+		}
+		return spotifySong(strings.TrimPrefix(u.Path, "/track/"))
+	case "soundcloud.com", "m.soundcloud.com":
+		if !soundCloudRegexp.MatchString(u.Path) {
+			return Song{}, ErrUnsupportedSong
+		}
+		path := strings.TrimSuffix(u.Path, "/")
+		return Song{
+			Provider: SongSoundCloud,
+			SongID:   strings.TrimPrefix(path, "/"),
+			URL:      "https://soundcloud.com" + path,
+		}, nil
+	}
+	return Song{}, ErrUnsupportedSong
+}
+
+func youtubeSong(id string) (Song, error) {
+	if !youtubeIDRegexp.MatchString(id) {
+		return Song{}, ErrUnsupportedSong
+	}
+	return Song{
+		Provider: SongYouTube,
+		SongID:   id,
+		URL:      "https://www.youtube.com/watch?v=" + id,
+	}, nil
+}
+
+func spotifySong(id string) (Song, error) {
+	if !spotifyIDRegexp.MatchString(id) {
+		return Song{}, ErrUnsupportedSong
+	}
+	return Song{
+		Provider: SongSpotify,
+		SongID:   id,
+		URL:      "https://open.spotify.com/track/" + id,
+	}, nil
+}
+
+// blocked reports whether the song matches anything on the blocked list.
+func (song Song) blocked(list []string) bool {
+	for _, blocked := range list {
+		blocked = strings.ToLower(strings.TrimSpace(blocked))
+		if blocked == "" {
+			continue
+		}
+		if strings.EqualFold(song.SongID, blocked) || strings.EqualFold(song.URL, blocked) ||
+			strings.Contains(strings.ToLower(song.Title), blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *claudineService) RequestSong(ctx context.Context, channel string, song Song) (Song, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if song.Provider == "" || (song.URL == "" && song.Title == "") {
+		return Song{}, ErrInvalidArgument
+	}
+	song.RequestedBy = strings.ToLower(song.RequestedBy)
+	song.RequestedAt = time.Now().UTC()
+
+	err := s.store.Update(func(tx Tx) error {
+		bucket, err := GetActiveChannelBucket(tx, channel)
+		if err != nil {
+			return err
+		}
+		settings, err := readSettings(bucket)
+		if err != nil {
+			return err
+		}
+
+		limits := settings.SongRequests
+		if song.blocked(limits.Blocked) {
+			return ErrSongBlocked
+		}
+		if limits.MaxLength > 0 && song.Duration > limits.MaxLength {
+			return ErrSongTooLong
+		}
+
+		sBucket, err := getChannelSubBucket(tx, channel, songsBucket, true)
+		if err != nil {
+			return err
+		}
+		queue, err := sBucket.CreateBucketIfNotExists(queueBucket)
+		if err != nil {
+			return err
+		}
+
+		if limits.UserLimit > 0 && song.RequestedBy != "" {
+			queued := 0
+			err := queue.ForEach(func(id, raw []byte) error {
+				var q Song
+				if err := json.Unmarshal(raw, &q); err != nil {
+					return err
+				}
+				if q.RequestedBy == song.RequestedBy {
+					queued++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if queued >= limits.UserLimit {
+				return ErrSongLimit
+			}
+		}
+
+		id, err := queue.NextSequence()
+		if err != nil {
+			return err
+		}
+		song.ID = int(id)
+
+		return putJSON(queue, itob(song.ID), song)
+	})
+	if err != nil {
+		return Song{}, err
+	}
+
+	return song, nil
+}
+
+func (s *claudineService) ListSong(ctx context.Context, channel string) ([]Song, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Song
+	err := s.store.View(func(tx Tx) error {
+		sBucket, err := getChannelSubBucket(tx, channel, songsBucket, false)
+		if err != nil || sBucket == nil {
+			return err
+		}
+
+		return sBucket.Bucket(queueBucket).ForEach(func(id, raw []byte) error {
+			var song Song
+			if err := json.Unmarshal(raw, &song); err != nil {
+				return err
+			}
+			list = append(list, song)
+			return nil
+		})
+	})
+	if err != nil {
+		return []Song{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) CurrentSong(ctx context.Context, channel string) (Song, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var song Song
+	err := s.store.View(func(tx Tx) error {
+		sBucket, err := getChannelSubBucket(tx, channel, songsBucket, false)
+		if err != nil {
+			return err
+		}
+		if sBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(sBucket, currentKey, &song)
+	})
+	if err != nil {
+		return Song{}, err
+	}
+
+	return song, nil
+}
+
+func (s *claudineService) NextSong(ctx context.Context, channel string) (Song, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var song Song
+	empty := false
+	err := s.store.Update(func(tx Tx) error {
+		sBucket, err := getChannelSubBucket(tx, channel, songsBucket, true)
+		if err != nil {
+			return err
+		}
+		queue, err := sBucket.CreateBucketIfNotExists(queueBucket)
+		if err != nil {
+			return err
+		}
+
+		var next []byte
+		err = queue.ForEach(func(id, raw []byte) error {
+			if next == nil {
+				next = id
+				return json.Unmarshal(raw, &song)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Nothing is playing once the queue runs out
+		if next == nil {
+			empty = true
+			return sBucket.Delete(currentKey)
+		}
+
+		if err := queue.Delete(next); err != nil {
+			return err
+		}
+		return putJSON(sBucket, currentKey, song)
+	})
+	if err != nil {
+		return Song{}, err
+	}
+	if empty {
+		return Song{}, ErrNotFound
+	}
+
+	return song, nil
+}
+
+func (s *claudineService) DeleteSong(ctx context.Context, channel string, id int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		sBucket, err := getChannelSubBucket(tx, channel, songsBucket, false)
+		if err != nil {
+			return err
+		}
+		if sBucket == nil {
+			return ErrNotFound
+		}
+
+		queue := sBucket.Bucket(queueBucket)
+		if queue.Get(itob(id)) == nil {
+			return ErrNotFound
+		}
+		return queue.Delete(itob(id))
+	})
+}
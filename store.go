@@ -0,0 +1,58 @@
+package claudine_bot
+
+import "errors"
+
+var (
+	ErrTxNotWritable     = errors.New("tx not writable")
+	ErrIncompatibleValue = errors.New("incompatible value")
+	ErrBucketNotFound    = errors.New("bucket not found")
+)
+
+// Store is a transactional key/value store made up of nested buckets. It
+// follows the semantics of bolt so the service doesn't depend on a single
+// storage engine.
+type Store interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(tx Tx) error) error
+
+	// Update runs fn in a read-write transaction. The transaction is rolled
+	// back if fn returns an error.
+	Update(fn func(tx Tx) error) error
+
+	Close() error
+}
+
+// Tx is a transaction on a Store.
+type Tx interface {
+	// Bucket returns the named top-level bucket, or nil if it doesn't exist.
+	Bucket(name []byte) Bucket
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+
+	// ForEach calls fn for every top-level bucket.
+	ForEach(fn func(name []byte, b Bucket) error) error
+}
+
+// Bucket is a collection of keys and nested buckets.
+type Bucket interface {
+	// Get returns the value of key, or nil if it doesn't exist or is a bucket.
+	Get(key []byte) []byte
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+
+	// ForEach calls fn for every key in the bucket in byte order. Nested
+	// buckets are included with a nil value.
+	ForEach(fn func(k, v []byte) error) error
+	// ForEachRange is ForEach for the keys from start up to but not including
+	// end, seeking to start rather than reading the keys before it. A nil end
+	// has no upper bound.
+	ForEachRange(start, end []byte, fn func(k, v []byte) error) error
+
+	// Bucket returns the named nested bucket, or nil if it doesn't exist.
+	Bucket(name []byte) Bucket
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+
+	// NextSequence returns an auto-incrementing integer for the bucket.
+	NextSequence() (uint64, error)
+}
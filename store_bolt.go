@@ -0,0 +1,129 @@
+package claudine_bot
+
+import (
+	"bytes"
+	bolt "github.com/etcd-io/bbolt"
+)
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore returns a Store backed by a bolt database.
+func NewBoltStore(db *bolt.DB) Store {
+	return &boltStore{db: db}
+}
+
+func (s *boltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	})
+}
+
+func (s *boltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx: tx})
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) Bucket(name []byte) Bucket {
+	return wrapBoltBucket(t.tx.Bucket(name))
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, convertBoltError(err)
+	}
+	return boltBucket{b: b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error {
+	return convertBoltError(t.tx.DeleteBucket(name))
+}
+
+func (t boltTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return fn(name, boltBucket{b: b})
+	})
+}
+
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+// wrapBoltBucket avoids returning a non-nil Bucket holding a nil *bolt.Bucket.
+func wrapBoltBucket(b *bolt.Bucket) Bucket {
+	if b == nil {
+		return nil
+	}
+	return boltBucket{b: b}
+}
+
+func (b boltBucket) Get(key []byte) []byte {
+	return b.b.Get(key)
+}
+
+func (b boltBucket) Put(key []byte, value []byte) error {
+	return convertBoltError(b.b.Put(key, value))
+}
+
+func (b boltBucket) Delete(key []byte) error {
+	return convertBoltError(b.b.Delete(key))
+}
+
+func (b boltBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.b.ForEach(fn)
+}
+
+func (b boltBucket) ForEachRange(start, end []byte, fn func(k, v []byte) error) error {
+	c := b.b.Cursor()
+	for k, v := c.Seek(start); k != nil && (end == nil || bytes.Compare(k, end) < 0); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b boltBucket) Bucket(name []byte) Bucket {
+	return wrapBoltBucket(b.b.Bucket(name))
+}
+
+func (b boltBucket) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	nested, err := b.b.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, convertBoltError(err)
+	}
+	return boltBucket{b: nested}, nil
+}
+
+func (b boltBucket) DeleteBucket(name []byte) error {
+	return convertBoltError(b.b.DeleteBucket(name))
+}
+
+func (b boltBucket) NextSequence() (uint64, error) {
+	return b.b.NextSequence()
+}
+
+// convertBoltError maps bolt errors onto the Store errors.
+func convertBoltError(err error) error {
+	switch err {
+	case bolt.ErrTxNotWritable:
+		return ErrTxNotWritable
+	case bolt.ErrIncompatibleValue:
+		return ErrIncompatibleValue
+	case bolt.ErrBucketNotFound:
+		return ErrBucketNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,19 @@
+package claudine_bot_test
+
+import (
+	bolt "github.com/etcd-io/bbolt"
+	"github.com/rcole5/claudine-bot"
+	"github.com/rcole5/claudine-bot/storetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	storetest.TestStore(t, func(t *testing.T) claudine_bot.Store {
+		db, err := bolt.Open(filepath.Join(t.TempDir(), "claudine.db"), 0600, nil)
+		if err != nil {
+			t.Fatalf("open bolt: %v", err)
+		}
+		return claudine_bot.NewBoltStore(db)
+	})
+}
@@ -0,0 +1,373 @@
+package claudine_bot
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Buckets form a tree through their parent, with 0 as the root. Keys belong to
+// a single bucket.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	parent   INTEGER NOT NULL,
+	name     BLOB NOT NULL,
+	sequence INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (parent, name)
+);
+CREATE TABLE IF NOT EXISTS kv (
+	bucket INTEGER NOT NULL,
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+);`
+
+// The id of the implicit root bucket.
+const sqliteRoot = 0
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens, and if needed creates, a Store in the SQLite database at path.
+func NewSQLiteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) View(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failed error
+	err = fn(sqliteTx{root: sqliteBucket{tx: tx, id: sqliteRoot, failed: &failed}})
+	if failed != nil {
+		// A lookup failing is the real cause of whatever fn returned
+		return failed
+	}
+	return err
+}
+
+func (s *sqliteStore) Update(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failed error
+	err = fn(sqliteTx{root: sqliteBucket{tx: tx, id: sqliteRoot, writable: true, failed: &failed}})
+	if failed != nil {
+		return failed
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+type sqliteTx struct {
+	root sqliteBucket
+}
+
+func (t sqliteTx) Bucket(name []byte) Bucket {
+	return t.root.Bucket(name)
+}
+
+func (t sqliteTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	return t.root.CreateBucketIfNotExists(name)
+}
+
+func (t sqliteTx) DeleteBucket(name []byte) error {
+	return t.root.DeleteBucket(name)
+}
+
+func (t sqliteTx) ForEach(fn func(name []byte, b Bucket) error) error {
+	return t.root.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		return fn(k, t.root.Bucket(k))
+	})
+}
+
+type sqliteBucket struct {
+	tx       *sql.Tx
+	id       int64
+	writable bool
+	// failed is shared by the whole transaction. Get and Bucket can't return
+	// errors, so they're kept here to fail the rest of the transaction.
+	failed *error
+}
+
+// fail records the first error of the transaction.
+func (b sqliteBucket) fail(err error) {
+	if *b.failed == nil {
+		*b.failed = err
+	}
+}
+
+// child returns the id of the named nested bucket, or false if there isn't one.
+func (b sqliteBucket) child(name []byte) (int64, bool, error) {
+	if *b.failed != nil {
+		return 0, false, *b.failed
+	}
+
+	var id int64
+	err := b.tx.QueryRow("SELECT id FROM buckets WHERE parent = ? AND name = ?", b.id, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		b.fail(err)
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// get returns the value of key, or nil if there isn't one.
+func (b sqliteBucket) get(key []byte) ([]byte, error) {
+	if *b.failed != nil {
+		return nil, *b.failed
+	}
+
+	var value []byte
+	err := b.tx.QueryRow("SELECT value FROM kv WHERE bucket = ? AND key = ?", b.id, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		b.fail(err)
+		return nil, err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+func (b sqliteBucket) Get(key []byte) []byte {
+	value, _ := b.get(key)
+	return value
+}
+
+func (b sqliteBucket) Put(key []byte, value []byte) error {
+	if !b.writable {
+		return ErrTxNotWritable
+	}
+	if _, ok, err := b.child(key); err != nil {
+		return err
+	} else if ok {
+		return ErrIncompatibleValue
+	}
+	if value == nil {
+		value = []byte{}
+	}
+
+	_, err := b.tx.Exec("INSERT OR REPLACE INTO kv (bucket, key, value) VALUES (?, ?, ?)", b.id, key, value)
+	return err
+}
+
+func (b sqliteBucket) Delete(key []byte) error {
+	if !b.writable {
+		return ErrTxNotWritable
+	}
+	if _, ok, err := b.child(key); err != nil {
+		return err
+	} else if ok {
+		return ErrIncompatibleValue
+	}
+
+	_, err := b.tx.Exec("DELETE FROM kv WHERE bucket = ? AND key = ?", b.id, key)
+	return err
+}
+
+func (b sqliteBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.ForEachRange(nil, nil, fn)
+}
+
+func (b sqliteBucket) ForEachRange(start, end []byte, fn func(k, v []byte) error) error {
+	if *b.failed != nil {
+		return *b.failed
+	}
+
+	kvWhere, bucketsWhere := "bucket = ?", "parent = ?"
+	kvArgs, bucketsArgs := []interface{}{b.id}, []interface{}{b.id}
+	if start != nil {
+		kvWhere, bucketsWhere = kvWhere+" AND key >= ?", bucketsWhere+" AND name >= ?"
+		kvArgs, bucketsArgs = append(kvArgs, start), append(bucketsArgs, start)
+	}
+	if end != nil {
+		kvWhere, bucketsWhere = kvWhere+" AND key < ?", bucketsWhere+" AND name < ?"
+		kvArgs, bucketsArgs = append(kvArgs, end), append(bucketsArgs, end)
+	}
+
+	rows, err := b.tx.Query(`
+		SELECT key, value, 0 FROM kv WHERE `+kvWhere+`
+		UNION ALL
+		SELECT name, x'', 1 FROM buckets WHERE `+bucketsWhere+`
+		ORDER BY 1`, append(kvArgs, bucketsArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	// Read everything up front so fn is free to use the transaction
+	type entry struct {
+		key, value []byte
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		var isBucket bool
+		if err := rows.Scan(&e.key, &e.value, &isBucket); err != nil {
+			rows.Close()
+			return err
+		}
+		if isBucket {
+			e.value = nil
+		} else if e.value == nil {
+			e.value = []byte{}
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := fn(e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b sqliteBucket) Bucket(name []byte) Bucket {
+	id, ok, err := b.child(name)
+	if err != nil || !ok {
+		return nil
+	}
+	return b.nested(id)
+}
+
+// nested returns the bucket with the given id in the same transaction.
+func (b sqliteBucket) nested(id int64) sqliteBucket {
+	return sqliteBucket{tx: b.tx, id: id, writable: b.writable, failed: b.failed}
+}
+
+func (b sqliteBucket) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	id, ok, err := b.child(name)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return b.nested(id), nil
+	}
+	if !b.writable {
+		return nil, ErrTxNotWritable
+	}
+	if value, err := b.get(name); err != nil {
+		return nil, err
+	} else if value != nil {
+		return nil, ErrIncompatibleValue
+	}
+
+	res, err := b.tx.Exec("INSERT INTO buckets (parent, name) VALUES (?, ?)", b.id, name)
+	if err != nil {
+		return nil, err
+	}
+	id, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return b.nested(id), nil
+}
+
+func (b sqliteBucket) DeleteBucket(name []byte) error {
+	if !b.writable {
+		return ErrTxNotWritable
+	}
+	id, ok, err := b.child(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if value, err := b.get(name); err != nil {
+			return err
+		} else if value != nil {
+			return ErrIncompatibleValue
+		}
+		return ErrBucketNotFound
+	}
+
+	// Find every bucket nested below this one
+	rows, err := b.tx.Query(`
+		WITH RECURSIVE nested(id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT buckets.id FROM buckets JOIN nested ON buckets.parent = nested.id
+		)
+		SELECT id FROM nested`, id)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var nested int64
+		if err := rows.Scan(&nested); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, nested)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, nested := range ids {
+		if _, err := b.tx.Exec("DELETE FROM kv WHERE bucket = ?", nested); err != nil {
+			return err
+		}
+		if _, err := b.tx.Exec("DELETE FROM buckets WHERE id = ?", nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b sqliteBucket) NextSequence() (uint64, error) {
+	if !b.writable {
+		return 0, ErrTxNotWritable
+	}
+	if *b.failed != nil {
+		return 0, *b.failed
+	}
+	if _, err := b.tx.Exec("UPDATE buckets SET sequence = sequence + 1 WHERE id = ?", b.id); err != nil {
+		return 0, err
+	}
+
+	var sequence uint64
+	err := b.tx.QueryRow("SELECT sequence FROM buckets WHERE id = ?", b.id).Scan(&sequence)
+	return sequence, err
+}
@@ -0,0 +1,18 @@
+package claudine_bot_test
+
+import (
+	"github.com/rcole5/claudine-bot"
+	"github.com/rcole5/claudine-bot/storetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.TestStore(t, func(t *testing.T) claudine_bot.Store {
+		s, err := claudine_bot.NewSQLiteStore(filepath.Join(t.TempDir(), "claudine.sqlite"))
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		return s
+	})
+}
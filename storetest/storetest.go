@@ -0,0 +1,381 @@
+// Package storetest is a conformance suite for claudine_bot.Store
+// implementations, so every backend behaves the same as bolt.
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rcole5/claudine-bot"
+	"testing"
+)
+
+// TestStore runs the suite against stores returned by newStore. Every call
+// must return a new, empty store.
+func TestStore(t *testing.T, newStore func(t *testing.T) claudine_bot.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s claudine_bot.Store)
+	}{
+		{"PutGet", testPutGet},
+		{"Delete", testDelete},
+		{"Rollback", testRollback},
+		{"ReadOnly", testReadOnly},
+		{"ForEach", testForEach},
+		{"ForEachRange", testForEachRange},
+		{"TxForEach", testTxForEach},
+		{"DeleteBucket", testDeleteBucket},
+		{"IncompatibleValue", testIncompatibleValue},
+		{"NextSequence", testNextSequence},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStore(t)
+			defer s.Close()
+			test.fn(t, s)
+		})
+	}
+}
+
+func mustUpdate(t *testing.T, s claudine_bot.Store, fn func(tx claudine_bot.Tx) error) {
+	t.Helper()
+	if err := s.Update(fn); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+}
+
+func mustView(t *testing.T, s claudine_bot.Store, fn func(tx claudine_bot.Tx) error) {
+	t.Helper()
+	if err := s.View(fn); err != nil {
+		t.Fatalf("view: %v", err)
+	}
+}
+
+func testPutGet(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		return b.Put([]byte("empty"), []byte{})
+	})
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		b := tx.Bucket([]byte("channel"))
+		if b == nil {
+			t.Fatal("bucket not found")
+		}
+		if got := b.Get([]byte("key")); !bytes.Equal(got, []byte("value")) {
+			t.Errorf("Get(key) = %q, want %q", got, "value")
+		}
+		if got := b.Get([]byte("empty")); got == nil || len(got) != 0 {
+			t.Errorf("Get(empty) = %#v, want empty non-nil value", got)
+		}
+		if got := b.Get([]byte("missing")); got != nil {
+			t.Errorf("Get(missing) = %q, want nil", got)
+		}
+		if tx.Bucket([]byte("missing")) != nil {
+			t.Error("Bucket(missing) should be nil")
+		}
+		return nil
+	})
+}
+
+func testDelete(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		return b.Delete([]byte("key"))
+	})
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		if got := tx.Bucket([]byte("channel")).Get([]byte("key")); got != nil {
+			t.Errorf("Get after Delete = %q, want nil", got)
+		}
+		return nil
+	})
+}
+
+func testRollback(t *testing.T, s claudine_bot.Store) {
+	errRollback := errors.New("rollback")
+	err := s.Update(func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		t.Fatalf("Update returned %v, want %v", err, errRollback)
+	}
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		if tx.Bucket([]byte("channel")) != nil {
+			t.Error("bucket should have been rolled back")
+		}
+		return nil
+	})
+}
+
+func testReadOnly(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		return err
+	})
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		b := tx.Bucket([]byte("channel"))
+		if err := b.Put([]byte("key"), []byte("value")); err != claudine_bot.ErrTxNotWritable {
+			t.Errorf("Put in View = %v, want %v", err, claudine_bot.ErrTxNotWritable)
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte("other")); err != claudine_bot.ErrTxNotWritable {
+			t.Errorf("CreateBucketIfNotExists in View = %v, want %v", err, claudine_bot.ErrTxNotWritable)
+		}
+		return nil
+	})
+}
+
+func testForEach(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"c", "a", "d"} {
+			if err := b.Put([]byte(k), []byte(k+k)); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucketIfNotExists([]byte("b"))
+		return err
+	})
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		var keys []string
+		err := tx.Bucket([]byte("channel")).ForEach(func(k, v []byte) error {
+			switch string(k) {
+			case "b":
+				if v != nil {
+					t.Errorf("nested bucket %q has value %q, want nil", k, v)
+				}
+			default:
+				if !bytes.Equal(v, append(k, k...)) {
+					t.Errorf("value of %q = %q", k, v)
+				}
+			}
+			keys = append(keys, string(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		want := []string{"a", "b", "c", "d"}
+		if len(keys) != len(want) {
+			t.Fatalf("ForEach keys = %v, want %v", keys, want)
+		}
+		for i := range want {
+			if keys[i] != want[i] {
+				t.Fatalf("ForEach keys = %v, want %v", keys, want)
+			}
+		}
+		return nil
+	})
+}
+
+func testForEachRange(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "c", "ca", "d", "e"} {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		_, err = b.CreateBucketIfNotExists([]byte("b"))
+		return err
+	})
+
+	tests := []struct {
+		start, end string
+		want       []string
+	}{
+		{"", "", []string{"a", "b", "c", "ca", "d", "e"}},
+		{"b", "d", []string{"b", "c", "ca"}},
+		{"bb", "", []string{"c", "ca", "d", "e"}},
+		{"", "c", []string{"a", "b"}},
+		{"f", "", nil},
+	}
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		for _, test := range tests {
+			var start, end []byte
+			if test.start != "" {
+				start = []byte(test.start)
+			}
+			if test.end != "" {
+				end = []byte(test.end)
+			}
+
+			var keys []string
+			err := tx.Bucket([]byte("channel")).ForEachRange(start, end, func(k, v []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(keys) != len(test.want) {
+				t.Fatalf("ForEachRange(%q, %q) keys = %v, want %v", test.start, test.end, keys, test.want)
+			}
+			for i := range test.want {
+				if keys[i] != test.want[i] {
+					t.Fatalf("ForEachRange(%q, %q) keys = %v, want %v", test.start, test.end, keys, test.want)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func testTxForEach(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		for _, name := range []string{"two", "one"} {
+			b, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("name"), []byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	mustView(t, s, func(tx claudine_bot.Tx) error {
+		var names []string
+		err := tx.ForEach(func(name []byte, b claudine_bot.Bucket) error {
+			if got := b.Get([]byte("name")); !bytes.Equal(got, name) {
+				t.Errorf("bucket %q has name %q", name, got)
+			}
+			names = append(names, string(name))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(names) != 2 || names[0] != "one" || names[1] != "two" {
+			t.Errorf("ForEach buckets = %v, want [one two]", names)
+		}
+		return nil
+	})
+}
+
+func testDeleteBucket(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		nested, err := b.CreateBucketIfNotExists([]byte("commands"))
+		if err != nil {
+			return err
+		}
+		return nested.Put([]byte("hello"), []byte("world"))
+	})
+
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		return tx.DeleteBucket([]byte("channel"))
+	})
+
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		if tx.Bucket([]byte("channel")) != nil {
+			t.Fatal("bucket should have been deleted")
+		}
+
+		// Nested buckets must not survive being recreated
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		if b.Bucket([]byte("commands")) != nil {
+			t.Error("nested bucket should have been deleted")
+		}
+
+		if err := tx.DeleteBucket([]byte("missing")); err != claudine_bot.ErrBucketNotFound {
+			t.Errorf("DeleteBucket(missing) = %v, want %v", err, claudine_bot.ErrBucketNotFound)
+		}
+		return nil
+	})
+}
+
+func testIncompatibleValue(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		if _, err := b.CreateBucketIfNotExists([]byte("commands")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("enabled"), []byte{1}); err != nil {
+			return err
+		}
+
+		if err := b.Put([]byte("commands"), []byte("value")); err != claudine_bot.ErrIncompatibleValue {
+			t.Errorf("Put over a bucket = %v, want %v", err, claudine_bot.ErrIncompatibleValue)
+		}
+		if _, err := b.CreateBucketIfNotExists([]byte("enabled")); err != claudine_bot.ErrIncompatibleValue {
+			t.Errorf("CreateBucketIfNotExists over a value = %v, want %v", err, claudine_bot.ErrIncompatibleValue)
+		}
+		if got := b.Get([]byte("commands")); got != nil {
+			t.Errorf("Get of a bucket = %q, want nil", got)
+		}
+		return nil
+	})
+}
+
+func testNextSequence(t *testing.T, s claudine_bot.Store) {
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("channel"))
+		if err != nil {
+			return err
+		}
+		for want := uint64(1); want <= 3; want++ {
+			got, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if got != want {
+				t.Errorf("NextSequence = %d, want %d", got, want)
+			}
+		}
+		return nil
+	})
+
+	// The sequence survives the transaction
+	mustUpdate(t, s, func(tx claudine_bot.Tx) error {
+		got, err := tx.Bucket([]byte("channel")).NextSequence()
+		if err != nil {
+			return err
+		}
+		if got != 4 {
+			t.Errorf("NextSequence = %d, want 4", got)
+		}
+		return nil
+	})
+}
@@ -10,18 +10,22 @@ import (
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 var (
 	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
 )
 
-func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
+func MakeHTTPHandler(s Service, adminToken string, logger log.Logger) http.Handler {
 	r := mux.NewRouter().StrictSlash(false).PathPrefix("/api/v1").Subrouter()
 	e := MakeServerEndpoints(s)
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorLogger(logger),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(requestIDToContext),
+		httptransport.ServerAfter(requestIDToResponse),
 	}
 	// Channels
 	r.Methods("POST").Path("/channels").Handler(httptransport.NewServer(
@@ -101,9 +105,683 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 		options...,
 	))
 
+	// Settings
+	r.Methods("GET").Path("/channels/{channel}/settings").Handler(httptransport.NewServer(
+		e.GetSettingsEndpoint,
+		decodeGetSettingsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/channels/{channel}/settings").Handler(httptransport.NewServer(
+		e.UpdateSettingsEndpoint,
+		decodeUpdateSettingsRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Counters
+	r.Methods("GET").Path("/channels/{channel}/counters").Handler(httptransport.NewServer(
+		e.ListCounterEndpoint,
+		decodeListCounterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/channels/{channel}/counters").Handler(httptransport.NewServer(
+		e.NewCounterEndpoint,
+		decodeNewCounterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/counters/{name}").Handler(httptransport.NewServer(
+		e.GetCounterEndpoint,
+		decodeGetCounterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/channels/{channel}/counters/{name}").Handler(httptransport.NewServer(
+		e.SetCounterEndpoint,
+		decodeSetCounterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/channels/{channel}/counters/{name}/increment").Handler(httptransport.NewServer(
+		e.IncrementCounterEndpoint,
+		decodeIncrementCounterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/channels/{channel}/counters/{name}/reset").Handler(httptransport.NewServer(
+		e.ResetCounterEndpoint,
+		decodeResetCounterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/channels/{channel}/counters/{name}").Handler(httptransport.NewServer(
+		e.DeleteCounterEndpoint,
+		decodeDeleteCounterRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Quotes
+	r.Methods("GET").Path("/channels/{channel}/quotes").Handler(httptransport.NewServer(
+		e.ListQuoteEndpoint,
+		decodeListQuoteRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/channels/{channel}/quotes").Handler(httptransport.NewServer(
+		e.NewQuoteEndpoint,
+		decodeNewQuoteRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/quotes/{id:[0-9]+}").Handler(httptransport.NewServer(
+		e.GetQuoteEndpoint,
+		decodeGetQuoteRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/channels/{channel}/quotes/{id:[0-9]+}").Handler(httptransport.NewServer(
+		e.UpdateQuoteEndpoint,
+		decodeUpdateQuoteRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/channels/{channel}/quotes/{id:[0-9]+}").Handler(httptransport.NewServer(
+		e.DeleteQuoteEndpoint,
+		decodeDeleteQuoteRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Points
+	r.Methods("GET").Path("/channels/{channel}/points").Handler(httptransport.NewServer(
+		e.ListPointsEndpoint,
+		decodeListPointsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/points/{user}").Handler(httptransport.NewServer(
+		e.GetPointsEndpoint,
+		decodeGetPointsRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Raffles
+	r.Methods("GET").Path("/channels/{channel}/raffles").Handler(httptransport.NewServer(
+		e.ListRaffleEndpoint,
+		decodeListRaffleRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/raffles/{id:[0-9]+}").Handler(httptransport.NewServer(
+		e.GetRaffleEndpoint,
+		decodeGetRaffleRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Polls
+	r.Methods("GET").Path("/channels/{channel}/polls").Handler(httptransport.NewServer(
+		e.ListPollEndpoint,
+		decodeListPollRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/polls/{id:[0-9]+}").Handler(httptransport.NewServer(
+		e.GetPollEndpoint,
+		decodeGetPollRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Song requests
+	r.Methods("GET").Path("/channels/{channel}/songs").Handler(httptransport.NewServer(
+		e.ListSongEndpoint,
+		decodeListSongRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/songs/current").Handler(httptransport.NewServer(
+		e.CurrentSongEndpoint,
+		decodeCurrentSongRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/channels/{channel}/songs/next").Handler(httptransport.NewServer(
+		e.NextSongEndpoint,
+		decodeNextSongRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/channels/{channel}/songs/{id:[0-9]+}").Handler(httptransport.NewServer(
+		e.DeleteSongEndpoint,
+		decodeDeleteSongRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Moderation
+	r.Methods("GET").Path("/channels/{channel}/moderation").Handler(httptransport.NewServer(
+		e.ListModActionEndpoint,
+		decodeListModActionRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Event responses
+	r.Methods("GET").Path("/channels/{channel}/event-responses").Handler(httptransport.NewServer(
+		e.ListEventResponseEndpoint,
+		decodeListEventResponseRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/channels/{channel}/event-responses/{event}").Handler(httptransport.NewServer(
+		e.GetEventResponseEndpoint,
+		decodeGetEventResponseRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/channels/{channel}/event-responses/{event}").Handler(httptransport.NewServer(
+		e.SetEventResponseEndpoint,
+		decodeSetEventResponseRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/channels/{channel}/event-responses/{event}").Handler(httptransport.NewServer(
+		e.DeleteEventResponseEndpoint,
+		decodeDeleteEventResponseRequest,
+		encodeResponse,
+		options...,
+	))
+
+	// Webhooks make the bot send requests and their URLs and payloads can hold
+	// tokens, so every webhook route needs the admin token
+	r.Methods("GET").Path("/channels/{channel}/webhooks").Handler(requireAdmin(adminToken, httptransport.NewServer(
+		e.ListWebhookEndpoint,
+		decodeListWebhookRequest,
+		encodeResponse,
+		options...,
+	)))
+	r.Methods("POST").Path("/channels/{channel}/webhooks").Handler(requireAdmin(adminToken, httptransport.NewServer(
+		e.AddWebhookEndpoint,
+		decodeAddWebhookRequest,
+		encodeResponse,
+		options...,
+	)))
+	r.Methods("DELETE").Path("/channels/{channel}/webhooks/{id:[0-9]+}").Handler(requireAdmin(adminToken, httptransport.NewServer(
+		e.DeleteWebhookEndpoint,
+		decodeDeleteWebhookRequest,
+		encodeResponse,
+		options...,
+	)))
+	r.Methods("GET").Path("/channels/{channel}/webhooks/dead-letters").Handler(requireAdmin(adminToken, httptransport.NewServer(
+		e.ListWebhookDeadLetterEndpoint,
+		decodeListWebhookDeadLetterRequest,
+		encodeResponse,
+		options...,
+	)))
+	r.Methods("DELETE").Path("/channels/{channel}/webhooks/dead-letters/{id:[0-9]+}").Handler(requireAdmin(adminToken, httptransport.NewServer(
+		e.DeleteWebhookDeadLetterEndpoint,
+		decodeDeleteWebhookDeadLetterRequest,
+		encodeResponse,
+		options...,
+	)))
+	r.Methods("GET").Path("/channels/{channel}/webhooks/deliveries").Handler(requireAdmin(adminToken, httptransport.NewServer(
+		e.ListWebhookAttemptEndpoint,
+		decodeListWebhookAttemptRequest,
+		encodeResponse,
+		options...,
+	)))
+
 	return r
 }
 
+// channelAndID reads the channel and numeric id route variables.
+func channelAndID(r *http.Request) (string, int, error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return "", 0, ErrBadRouting
+	}
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return "", 0, ErrBadRouting
+	}
+	return channel, id, nil
+}
+
+func decodeListQuoteRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listQuoteRequest{Channel: channel, Search: r.URL.Query().Get("search")}, nil
+}
+
+func decodeNewQuoteRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	req := newQuoteRequest{Channel: channel}
+	if e := json.NewDecoder(r.Body).Decode(&req.Quote); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetQuoteRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return getQuoteRequest{Channel: channel, ID: id}, nil
+}
+
+func decodeUpdateQuoteRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var req updateQuoteRequest
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil {
+		return nil, e
+	}
+	req.Channel = channel
+	req.ID = id
+	return req, nil
+}
+
+func decodeDeleteQuoteRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return deleteQuoteRequest{Channel: channel, ID: id}, nil
+}
+
+func decodeListCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listCounterRequest{Channel: channel}, nil
+}
+
+func decodeNewCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	var req newCounterRequest
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil {
+		return nil, e
+	}
+	req.Channel = channel
+	return req, nil
+}
+
+func decodeGetCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	name, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getCounterRequest{Channel: channel, Name: name}, nil
+}
+
+func decodeSetCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	name, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	var req setCounterRequest
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil {
+		return nil, e
+	}
+	req.Channel = channel
+	req.Name = name
+	return req, nil
+}
+
+func decodeIncrementCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	name, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	var req incrementCounterRequest
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil {
+		return nil, e
+	}
+	req.Channel = channel
+	req.Name = name
+	return req, nil
+}
+
+func decodeResetCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	name, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return resetCounterRequest{Channel: channel, Name: name}, nil
+}
+
+func decodeDeleteCounterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	name, ok := vars["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteCounterRequest{Channel: channel, Name: name}, nil
+}
+
+// decodeListPointsRequest reads an optional ?limit=, defaulting to the top 10.
+func decodeListPointsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	req := listPointsRequest{Channel: channel, Limit: 10}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		req.Limit, err = strconv.Atoi(limit)
+		if err != nil || req.Limit < 0 {
+			return nil, ErrInvalidArgument
+		}
+	}
+	return req, nil
+}
+
+func decodeGetPointsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	user, ok := vars["user"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getPointsRequest{Channel: channel, User: user}, nil
+}
+
+func decodeListRaffleRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listRaffleRequest{Channel: channel}, nil
+}
+
+func decodeGetRaffleRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return getRaffleRequest{Channel: channel, ID: id}, nil
+}
+
+func decodeListPollRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listPollRequest{Channel: channel}, nil
+}
+
+func decodeGetPollRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return getPollRequest{Channel: channel, ID: id}, nil
+}
+
+func decodeListSongRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listSongRequest{Channel: channel}, nil
+}
+
+func decodeCurrentSongRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return currentSongRequest{Channel: channel}, nil
+}
+
+func decodeNextSongRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return nextSongRequest{Channel: channel}, nil
+}
+
+func decodeDeleteSongRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return deleteSongRequest{Channel: channel, ID: id}, nil
+}
+
+// decodeListModActionRequest reads the optional ?target=, ?type=, ?since= (RFC
+// 3339) and ?limit= filters.
+func decodeListModActionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	query := r.URL.Query()
+	req := listModActionRequest{
+		Channel: channel,
+		Query: ModActionQuery{
+			Target: query.Get("target"),
+			Type:   query.Get("type"),
+		},
+	}
+	if since := query.Get("since"); since != "" {
+		req.Query.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		req.Query.Limit, err = strconv.Atoi(limit)
+		if err != nil || req.Query.Limit < 0 {
+			return nil, ErrInvalidArgument
+		}
+	}
+	return req, nil
+}
+
+// channelAndEvent reads the channel and event route variables.
+func channelAndEvent(r *http.Request) (string, string, error) {
+	vars := mux.Vars(r)
+	channel, ok := vars["channel"]
+	if !ok {
+		return "", "", ErrBadRouting
+	}
+
+	event, ok := vars["event"]
+	if !ok {
+		return "", "", ErrBadRouting
+	}
+	return channel, event, nil
+}
+
+func decodeListEventResponseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listEventResponseRequest{Channel: channel}, nil
+}
+
+func decodeGetEventResponseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, event, err := channelAndEvent(r)
+	if err != nil {
+		return nil, err
+	}
+	return getEventResponseRequest{Channel: channel, Event: event}, nil
+}
+
+func decodeSetEventResponseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, event, err := channelAndEvent(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := setEventResponseRequest{Channel: channel}
+	if e := json.NewDecoder(r.Body).Decode(&req.Response); e != nil {
+		return nil, e
+	}
+	req.Response.Event = event
+	return req, nil
+}
+
+func decodeDeleteEventResponseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, event, err := channelAndEvent(r)
+	if err != nil {
+		return nil, err
+	}
+	return deleteEventResponseRequest{Channel: channel, Event: event}, nil
+}
+
+func decodeListWebhookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listWebhookRequest{Channel: channel}, nil
+}
+
+func decodeAddWebhookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	req := addWebhookRequest{Channel: channel}
+	if e := json.NewDecoder(r.Body).Decode(&req.Webhook); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeDeleteWebhookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return deleteWebhookRequest{Channel: channel, ID: id}, nil
+}
+
+func decodeListWebhookDeadLetterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listWebhookDeadLetterRequest{Channel: channel}, nil
+}
+
+func decodeDeleteWebhookDeadLetterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, id, err := channelAndID(r)
+	if err != nil {
+		return nil, err
+	}
+	return deleteWebhookDeadLetterRequest{Channel: channel, ID: id}, nil
+}
+
+// decodeListWebhookAttemptRequest reads optional ?webhook= and ?limit=
+// filters, defaulting to the last 50 attempts.
+func decodeListWebhookAttemptRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	query := r.URL.Query()
+	req := listWebhookAttemptRequest{Channel: channel, Query: WebhookAttemptQuery{Limit: 50}}
+	if webhook := query.Get("webhook"); webhook != "" {
+		req.Query.WebhookID, err = strconv.Atoi(webhook)
+		if err != nil || req.Query.WebhookID < 1 {
+			return nil, ErrInvalidArgument
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		req.Query.Limit, err = strconv.Atoi(limit)
+		if err != nil || req.Query.Limit < 0 {
+			return nil, ErrInvalidArgument
+		}
+	}
+	return req, nil
+}
+
+func decodeGetSettingsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getSettingsRequest{Channel: channel}, nil
+}
+
+func decodeUpdateSettingsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	channel, ok := mux.Vars(r)["channel"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+
+	req := updateSettingsRequest{Channel: channel}
+	if e := json.NewDecoder(r.Body).Decode(&req.Settings); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
 func decodeNewRepeatRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	var req newRepeatRequest
 	if e := json.NewDecoder(r.Body).Decode(&req); e != nil {
@@ -300,8 +978,17 @@ func codeFrom(err error) int {
 	switch err {
 	case ErrNotFound:
 		return http.StatusNotFound
-	case ErrAlreadyExist:
+	case ErrAlreadyExist, ErrInvalidSettings, ErrInvalidArgument, ErrInsufficientPoints,
+		ErrUnsupportedSong, ErrSongBlocked, ErrSongTooLong, ErrSongLimit:
 		return http.StatusBadRequest
+	case ErrUnauthorized:
+		return http.StatusUnauthorized
+	case ErrRateLimited:
+		return http.StatusTooManyRequests
+	case ErrSnapshotUnsupported:
+		return http.StatusNotImplemented
+	case ErrNotConnected:
+		return http.StatusServiceUnavailable
 	default:
 		return http.StatusInternalServerError
 	}
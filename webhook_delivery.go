@@ -0,0 +1,374 @@
+package claudine_bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Most events waiting to be queued before new ones are dropped.
+const webhookEventsSize = 1000
+
+// WebhookDispatcher queues events for channel webhooks and delivers them,
+// retrying failures with exponential backoff. Deliveries that never go through
+// are kept as dead letters.
+type WebhookDispatcher struct {
+	service Service
+	client  *http.Client
+	logger  log.Logger
+
+	// RetryBase is the wait before the first retry, doubling after each
+	// failure up to RetryMax.
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// MaxAttempts is how many times a delivery is tried before it becomes a
+	// dead letter.
+	MaxAttempts int
+	// PollInterval is how often the queue is checked for due retries.
+	PollInterval time.Duration
+	// Workers is how many webhooks are sent to at once.
+	Workers int
+
+	events chan webhookEvent
+	wake   chan struct{}
+}
+
+type webhookEvent struct {
+	channel string
+	vars    WebhookVariables
+}
+
+// NewWebhookDispatcher returns a dispatcher sending with client, or if it is
+// nil, a client with a 10 second timeout that only connects to public
+// addresses.
+func NewWebhookDispatcher(s Service, client *http.Client, logger log.Logger) *WebhookDispatcher {
+	if client == nil {
+		client = &http.Client{
+			Timeout: 10 * time.Second,
+			// No proxy, the dialer has to see where requests really go
+			Transport: &http.Transport{
+				DialContext:         webhookDialer.DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		}
+	}
+	return &WebhookDispatcher{
+		service:      s,
+		client:       client,
+		logger:       logger,
+		RetryBase:    5 * time.Second,
+		RetryMax:     time.Hour,
+		MaxAttempts:  8,
+		PollInterval: time.Second,
+		Workers:      4,
+		events:       make(chan webhookEvent, webhookEventsSize),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Notify hands an event to the dispatcher, which queues it for each of the
+// channel's webhooks that wants it. It never blocks chat or commands; events
+// are dropped if too many are waiting.
+func (d *WebhookDispatcher) Notify(channel string, vars WebhookVariables) {
+	select {
+	case d.events <- webhookEvent{channel: channel, vars: vars}:
+	default:
+		d.logger.Log("msg", "dropped webhook event, too many waiting", "channel", channel, "event", vars.Event)
+	}
+}
+
+// queueEvents queues the events handed to Notify until ctx is cancelled, and
+// then the ones still waiting.
+func (d *WebhookDispatcher) queueEvents(ctx context.Context) {
+	for {
+		select {
+		case e := <-d.events:
+			d.queue(e.channel, e.vars)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-d.events:
+					d.queue(e.channel, e.vars)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// queue queues an event for each of the channel's webhooks that wants it.
+func (d *WebhookDispatcher) queue(channel string, vars WebhookVariables) {
+	ctx := context.Background()
+	hooks, err := d.service.ListWebhook(ctx, channel)
+	if err != nil {
+		d.logger.Log("msg", "failed to list webhooks", "channel", channel, "err", err)
+		return
+	}
+
+	for _, w := range hooks {
+		if !w.Wants(vars.Event) {
+			continue
+		}
+
+		delivery := WebhookDelivery{Channel: channel, WebhookID: w.ID, Event: vars.Event}
+		payload, err := w.Payload(vars)
+		if err != nil {
+			// A broken template won't get better by retrying
+			delivery.LastError = err.Error()
+			if _, err := d.service.DeadLetterWebhookDelivery(ctx, delivery); err != nil {
+				d.logger.Log("msg", "failed to keep dead letter", "channel", channel, "webhook", w.ID, "err", err)
+			}
+			continue
+		}
+		delivery.Payload = payload
+
+		if _, err := d.service.QueueWebhookDelivery(ctx, delivery); err != nil {
+			d.logger.Log("msg", "failed to queue webhook delivery", "channel", channel, "webhook", w.ID, "err", err)
+		}
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers queued events until ctx is cancelled, picking up whatever was
+// left in the queue by the last run.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.queueEvents(ctx)
+	}()
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue makes one attempt at each of the next deliveries that are due.
+// Each webhook gets its deliveries in order, while up to Workers webhooks are
+// sent to at once so a slow one doesn't hold up the rest.
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) {
+	due, err := d.service.DueWebhookDelivery(ctx, time.Now().UTC(), 50)
+	if err != nil {
+		d.logger.Log("msg", "failed to read webhook queue", "err", err)
+		return
+	}
+
+	type hook struct {
+		channel string
+		id      int
+	}
+	var hooks []hook
+	byHook := make(map[hook][]WebhookDelivery)
+	for _, delivery := range due {
+		h := hook{channel: delivery.Channel, id: delivery.WebhookID}
+		if _, ok := byHook[h]; !ok {
+			hooks = append(hooks, h)
+		}
+		byHook[h] = append(byHook[h], delivery)
+	}
+
+	workers := d.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, h := range hooks {
+		deliveries := byHook[h]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			for _, delivery := range deliveries {
+				if ctx.Err() != nil {
+					return
+				}
+				d.attempt(ctx, delivery)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt tries a delivery once, then takes it off the queue, reschedules it
+// or gives up on it.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery WebhookDelivery) {
+	w, err := d.service.GetWebhook(ctx, delivery.Channel, delivery.WebhookID)
+	if err == ErrNotFound {
+		// The webhook or its channel was removed
+		d.service.DeleteWebhookDelivery(ctx, delivery.ID)
+		return
+	}
+	if err != nil {
+		d.logger.Log("msg", "failed to get webhook", "channel", delivery.Channel, "webhook", delivery.WebhookID, "err", err)
+		return
+	}
+
+	begin := time.Now()
+	status, err := d.send(ctx, w, delivery.Event, delivery.Payload)
+	if ctx.Err() != nil {
+		// Shutting down, the delivery stays queued as it was
+		return
+	}
+	delivery.Attempts++
+
+	attempt := WebhookAttempt{
+		DeliveryID: delivery.ID,
+		WebhookID:  w.ID,
+		Event:      delivery.Event,
+		Attempt:    delivery.Attempts,
+		StatusCode: status,
+		Took:       time.Since(begin).Seconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	if _, logErr := d.service.LogWebhookAttempt(ctx, delivery.Channel, attempt); logErr != nil {
+		d.logger.Log("msg", "failed to log webhook attempt", "channel", delivery.Channel, "webhook", w.ID, "err", logErr)
+	}
+
+	switch {
+	case err == nil:
+		err = d.service.DeleteWebhookDelivery(ctx, delivery.ID)
+	case delivery.Attempts >= d.MaxAttempts:
+		d.logger.Log("msg", "giving up on webhook delivery", "channel", delivery.Channel, "webhook", w.ID, "attempts", delivery.Attempts, "err", err)
+		delivery.LastError = err.Error()
+		_, err = d.service.DeadLetterWebhookDelivery(ctx, delivery)
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = time.Now().UTC().Add(d.backoff(delivery.Attempts))
+		err = d.service.RetryWebhookDelivery(ctx, delivery)
+	}
+	if err != nil && err != ErrNotFound {
+		d.logger.Log("msg", "failed to update webhook queue", "channel", delivery.Channel, "delivery", delivery.ID, "err", err)
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	wait := d.RetryBase
+	for i := 1; i < attempts && wait < d.RetryMax; i++ {
+		wait *= 2
+	}
+	if wait > d.RetryMax {
+		wait = d.RetryMax
+	}
+	return wait
+}
+
+// Send makes one delivery of a payload. The payload is signed in the
+// X-Claudine-Signature header as sha256=<hex HMAC>.
+func (d *WebhookDispatcher) Send(ctx context.Context, w Webhook, event string, payload []byte) error {
+	_, err := d.send(ctx, w, event, payload)
+	return err
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, w Webhook, event string, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "claudine-bot")
+	req.Header.Set("X-Claudine-Event", event)
+	req.Header.Set("X-Claudine-Webhook", strconv.Itoa(w.ID))
+	req.Header.Set("X-Claudine-Signature", "sha256="+w.Sign(payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// MakeWebhookTestHandler sends a sample stream_online event to one webhook,
+// once, so it can be checked. The request needs the admin token:
+//
+//	POST /api/v1/webhooks/test?channel=name&id=1
+func MakeWebhookTestHandler(d *WebhookDispatcher, adminToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, adminToken) {
+			encodeError(r.Context(), ErrUnauthorized, w)
+			return
+		}
+
+		channel := r.URL.Query().Get("channel")
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if channel == "" || err != nil {
+			encodeError(r.Context(), ErrInvalidArgument, w)
+			return
+		}
+
+		hook, err := d.service.GetWebhook(r.Context(), channel, id)
+		if err != nil {
+			encodeError(r.Context(), err, w)
+			return
+		}
+
+		now := time.Now().UTC()
+		payload, err := hook.Payload(WebhookVariables{
+			Event:     EventStreamOnline,
+			Channel:   channel,
+			URL:       "https://twitch.tv/" + channel,
+			Title:     "Test stream",
+			Game:      "Just Chatting",
+			StartedAt: now,
+			Message:   channel + " is live: Test stream https://twitch.tv/" + channel,
+			Time:      now,
+		})
+		if err == nil {
+			err = d.Send(r.Context(), hook, EventStreamOnline, payload)
+		}
+
+		result := struct {
+			Delivered bool   `json:"delivered"`
+			Error     string `json:"error,omitempty"`
+		}{Delivered: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(result)
+	})
+}
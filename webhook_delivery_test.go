@@ -0,0 +1,214 @@
+package claudine_bot_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-kit/kit/log"
+	"github.com/rcole5/claudine-bot"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer records the requests it gets and answers each with the next
+// status, or 200 once they run out.
+type webhookServer struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	statuses []int
+	requests []webhookRequest
+}
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	ws := &webhookServer{statuses: statuses}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+
+		ws.mtx.Lock()
+		ws.requests = append(ws.requests, webhookRequest{header: r.Header, body: body, at: time.Now()})
+		status := http.StatusOK
+		if len(ws.statuses) > 0 {
+			status, ws.statuses = ws.statuses[0], ws.statuses[1:]
+		}
+		ws.mtx.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ws.Close)
+	return ws
+}
+
+// waitRequests waits for the server to get n requests and returns them.
+func (ws *webhookServer) waitRequests(t *testing.T, n int) []webhookRequest {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ws.mtx.Lock()
+		requests := append([]webhookRequest(nil), ws.requests...)
+		ws.mtx.Unlock()
+		if len(requests) >= n {
+			return requests
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("webhook server didn't get %d requests", n)
+	return nil
+}
+
+// newWebhookTest makes a service with a channel that has a webhook for the
+// server, and a dispatcher for it running until the test ends.
+func newWebhookTest(t *testing.T, ws *webhookServer) (claudine_bot.Service, claudine_bot.Webhook, *claudine_bot.WebhookDispatcher) {
+	// The test server listens on loopback
+	claudine_bot.AllowPrivateWebhooks = true
+	t.Cleanup(func() { claudine_bot.AllowPrivateWebhooks = false })
+
+	store, err := claudine_bot.NewSQLiteStore(filepath.Join(t.TempDir(), "claudine.sqlite"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := claudine_bot.Migrate(store, log.NewNopLogger()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	ctx := context.Background()
+	s := claudine_bot.NewClaudineService(store, log.NewNopLogger())
+	if _, err := s.NewChannel(ctx, "channel"); err != nil {
+		t.Fatalf("new channel: %v", err)
+	}
+	w, err := s.AddWebhook(ctx, "channel", claudine_bot.Webhook{URL: ws.URL, Format: claudine_bot.WebhookFormatJSON})
+	if err != nil {
+		t.Fatalf("add webhook: %v", err)
+	}
+
+	d := claudine_bot.NewWebhookDispatcher(s, ws.Client(), log.NewNopLogger())
+	d.RetryBase = 20 * time.Millisecond
+	d.RetryMax = 80 * time.Millisecond
+	d.MaxAttempts = 3
+	d.PollInterval = 5 * time.Millisecond
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		d.Run(runCtx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, w, d
+}
+
+func TestWebhookSignature(t *testing.T) {
+	ws := newWebhookServer(t)
+	_, w, d := newWebhookTest(t, ws)
+
+	d.Notify("channel", claudine_bot.WebhookVariables{Event: claudine_bot.EventStreamOnline, Channel: "channel"})
+	r := ws.waitRequests(t, 1)[0]
+
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(r.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := r.header.Get("X-Claudine-Signature"); got != want {
+		t.Fatalf("X-Claudine-Signature = %q, want %q", got, want)
+	}
+	if got := r.header.Get("X-Claudine-Event"); got != claudine_bot.EventStreamOnline {
+		t.Fatalf("X-Claudine-Event = %q, want %q", got, claudine_bot.EventStreamOnline)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	ws := newWebhookServer(t, http.StatusInternalServerError, http.StatusBadGateway)
+	s, w, d := newWebhookTest(t, ws)
+
+	d.Notify("channel", claudine_bot.WebhookVariables{Event: claudine_bot.EventStreamOnline, Channel: "channel"})
+	requests := ws.waitRequests(t, 3)
+
+	// Each retry waits twice as long as the one before
+	for i, wait := range []time.Duration{d.RetryBase, 2 * d.RetryBase} {
+		if gap := requests[i+1].at.Sub(requests[i].at); gap < wait {
+			t.Fatalf("attempt %d came %v after the last, want at least %v", i+2, gap, wait)
+		}
+	}
+
+	ctx := context.Background()
+	var attempts []claudine_bot.WebhookAttempt
+	deadline := time.Now().Add(5 * time.Second)
+	for len(attempts) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		var err error
+		attempts, err = s.ListWebhookAttempt(ctx, "channel", claudine_bot.WebhookAttemptQuery{WebhookID: w.ID})
+		if err != nil {
+			t.Fatalf("list attempts: %v", err)
+		}
+	}
+
+	// Attempts are listed newest first
+	wantStatuses := []int{http.StatusOK, http.StatusBadGateway, http.StatusInternalServerError}
+	if len(attempts) != len(wantStatuses) {
+		t.Fatalf("got %d attempts, want %d", len(attempts), len(wantStatuses))
+	}
+	for i, want := range wantStatuses {
+		if attempts[i].StatusCode != want {
+			t.Fatalf("attempt %d status = %d, want %d", attempts[i].Attempt, attempts[i].StatusCode, want)
+		}
+	}
+
+	if due, err := s.DueWebhookDelivery(ctx, time.Now().Add(time.Hour), 0); err != nil || len(due) != 0 {
+		t.Fatalf("queue = %v, %v, want it empty", due, err)
+	}
+	if dl, err := s.ListWebhookDeadLetter(ctx, "channel"); err != nil || len(dl) != 0 {
+		t.Fatalf("dead letters = %v, %v, want none", dl, err)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	ws := newWebhookServer(t, 500, 500, 500, 500)
+	s, _, d := newWebhookTest(t, ws)
+
+	d.Notify("channel", claudine_bot.WebhookVariables{Event: claudine_bot.EventStreamOffline, Channel: "channel"})
+	ws.waitRequests(t, d.MaxAttempts)
+
+	ctx := context.Background()
+	var dl []claudine_bot.WebhookDeadLetter
+	deadline := time.Now().Add(5 * time.Second)
+	for len(dl) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		var err error
+		dl, err = s.ListWebhookDeadLetter(ctx, "channel")
+		if err != nil {
+			t.Fatalf("list dead letters: %v", err)
+		}
+	}
+
+	if len(dl) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(dl))
+	}
+	if dl[0].Attempts != d.MaxAttempts || dl[0].Event != claudine_bot.EventStreamOffline {
+		t.Fatalf("dead letter = %+v, want %d attempts at %s", dl[0], d.MaxAttempts, claudine_bot.EventStreamOffline)
+	}
+	if due, err := s.DueWebhookDelivery(ctx, time.Now().Add(time.Hour), 0); err != nil || len(due) != 0 {
+		t.Fatalf("queue = %v, %v, want it empty", due, err)
+	}
+
+	// No attempts are made after giving up
+	time.Sleep(4 * d.RetryMax)
+	if n := len(ws.waitRequests(t, 0)); n != d.MaxAttempts {
+		t.Fatalf("webhook got %d requests, want %d", n, d.MaxAttempts)
+	}
+}
@@ -0,0 +1,333 @@
+package claudine_bot
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	webhookQueueBucket = []byte("webhook_queue")
+	// webhookScheduleBucket indexes the queue by when each delivery is next
+	// due, so due deliveries are found without reading the whole queue.
+	webhookScheduleBucket = []byte("webhook_schedule")
+	webhookAttemptsBucket = []byte("webhook_attempts")
+)
+
+// errEnoughDue stops reading the schedule once enough deliveries are due.
+var errEnoughDue = errors.New("enough due deliveries")
+
+// How many delivery attempts each channel keeps in its history.
+const webhookHistoryLimit = 500
+
+// WebhookDelivery is a payload queued to be sent to a webhook. The queue is
+// kept in the store so deliveries survive restarts.
+type WebhookDelivery struct {
+	ID          int             `json:"id"`
+	Channel     string          `json:"channel"`
+	WebhookID   int             `json:"webhook_id"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// WebhookAttempt is one try at a delivery, kept as delivery history.
+type WebhookAttempt struct {
+	ID         int    `json:"id"`
+	DeliveryID int    `json:"delivery_id"`
+	WebhookID  int    `json:"webhook_id"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	// StatusCode of the response, 0 if there wasn't one.
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	Took        float64   `json:"took_seconds"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// WebhookAttemptQuery narrows down the delivery history. Empty fields match
+// anything.
+type WebhookAttemptQuery struct {
+	WebhookID int
+	// Limit is the most attempts returned, 0 for all.
+	Limit int
+}
+
+// scheduleTime is the schedule key prefix of deliveries due at t.
+func scheduleTime(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+// scheduleKey is a delivery's key in the schedule, ordered by when it's next
+// due and then by ID.
+func scheduleKey(d WebhookDelivery) []byte {
+	return append(scheduleTime(d.NextAttempt), itob(d.ID)...)
+}
+
+// putQueued saves a delivery to the queue and the schedule.
+func putQueued(tx Tx, d WebhookDelivery) error {
+	qBucket, err := tx.CreateBucketIfNotExists(webhookQueueBucket)
+	if err != nil {
+		return err
+	}
+	sBucket, err := tx.CreateBucketIfNotExists(webhookScheduleBucket)
+	if err != nil {
+		return err
+	}
+
+	if err := putJSON(qBucket, itob(d.ID), d); err != nil {
+		return err
+	}
+	return sBucket.Put(scheduleKey(d), itob(d.ID))
+}
+
+// removeQueued takes a delivery off the queue and the schedule, returning
+// ErrNotFound if it isn't queued.
+func removeQueued(tx Tx, id int) error {
+	qBucket := tx.Bucket(webhookQueueBucket)
+	if qBucket == nil {
+		return ErrNotFound
+	}
+
+	var d WebhookDelivery
+	if err := getJSON(qBucket, itob(id), &d); err != nil {
+		return err
+	}
+	if sBucket := tx.Bucket(webhookScheduleBucket); sBucket != nil {
+		if err := sBucket.Delete(scheduleKey(d)); err != nil {
+			return err
+		}
+	}
+	return qBucket.Delete(itob(id))
+}
+
+func (s *claudineService) QueueWebhookDelivery(ctx context.Context, d WebhookDelivery) (WebhookDelivery, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	d.CreatedAt = time.Now().UTC()
+	if d.NextAttempt.IsZero() {
+		d.NextAttempt = d.CreatedAt
+	}
+
+	err := s.store.Update(func(tx Tx) error {
+		qBucket, err := tx.CreateBucketIfNotExists(webhookQueueBucket)
+		if err != nil {
+			return err
+		}
+
+		id, err := qBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		d.ID = int(id)
+
+		return putQueued(tx, d)
+	})
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	return d, nil
+}
+
+func (s *claudineService) DueWebhookDelivery(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []WebhookDelivery
+	err := s.store.View(func(tx Tx) error {
+		qBucket, sBucket := tx.Bucket(webhookQueueBucket), tx.Bucket(webhookScheduleBucket)
+		if qBucket == nil || sBucket == nil {
+			return nil
+		}
+
+		// Everything due by now sorts before anything due after it
+		end := scheduleTime(now.Add(time.Nanosecond))
+		return sBucket.ForEachRange(nil, end, func(key, id []byte) error {
+			if limit > 0 && len(list) >= limit {
+				return errEnoughDue
+			}
+
+			var d WebhookDelivery
+			if err := getJSON(qBucket, id, &d); err != nil {
+				return err
+			}
+			list = append(list, d)
+			return nil
+		})
+	})
+	if err == errEnoughDue {
+		err = nil
+	}
+	if err != nil {
+		return []WebhookDelivery{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) RetryWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		if err := removeQueued(tx, d.ID); err != nil {
+			return err
+		}
+		return putQueued(tx, d)
+	})
+}
+
+func (s *claudineService) DeleteWebhookDelivery(ctx context.Context, id int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		return removeQueued(tx, id)
+	})
+}
+
+func (s *claudineService) DeadLetterWebhookDelivery(ctx context.Context, d WebhookDelivery) (WebhookDeadLetter, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	dl := WebhookDeadLetter{
+		WebhookID: d.WebhookID,
+		Event:     d.Event,
+		Payload:   d.Payload,
+		Attempts:  d.Attempts,
+		Error:     d.LastError,
+		FailedAt:  time.Now().UTC(),
+	}
+
+	gone := false
+	err := s.store.Update(func(tx Tx) error {
+		// Deliveries whose payload couldn't be made were never queued
+		if err := removeQueued(tx, d.ID); err != nil && err != ErrNotFound {
+			return err
+		}
+
+		dBucket, err := getChannelSubBucket(tx, d.Channel, deadLettersBucket, true)
+		if err == ErrNotFound {
+			// The channel was removed, so the delivery is just dropped
+			gone = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if wBucket, err := getChannelSubBucket(tx, d.Channel, webhooksBucket, false); err == nil && wBucket != nil {
+			var w Webhook
+			if getJSON(wBucket, itob(d.WebhookID), &w) == nil {
+				dl.URL = w.URL
+			}
+		}
+
+		id, err := dBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		dl.ID = int(id)
+
+		return putJSON(dBucket, itob(dl.ID), dl)
+	})
+	if err != nil {
+		return WebhookDeadLetter{}, err
+	}
+	if gone {
+		return WebhookDeadLetter{}, ErrNotFound
+	}
+
+	return dl, nil
+}
+
+func (s *claudineService) LogWebhookAttempt(ctx context.Context, channel string, a WebhookAttempt) (WebhookAttempt, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if a.AttemptedAt.IsZero() {
+		a.AttemptedAt = time.Now().UTC()
+	}
+
+	err := s.store.Update(func(tx Tx) error {
+		aBucket, err := getChannelSubBucket(tx, channel, webhookAttemptsBucket, true)
+		if err != nil {
+			return err
+		}
+
+		id, err := aBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		a.ID = int(id)
+		if err := putJSON(aBucket, itob(a.ID), a); err != nil {
+			return err
+		}
+
+		// Drop the oldest attempts past the limit
+		var ids [][]byte
+		err = aBucket.ForEach(func(id, raw []byte) error {
+			ids = append(ids, append([]byte(nil), id...))
+			return nil
+		})
+		if err != nil || len(ids) <= webhookHistoryLimit {
+			return err
+		}
+		for _, id := range ids[:len(ids)-webhookHistoryLimit] {
+			if err := aBucket.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return WebhookAttempt{}, err
+	}
+
+	return a, nil
+}
+
+func (s *claudineService) ListWebhookAttempt(ctx context.Context, channel string, q WebhookAttemptQuery) ([]WebhookAttempt, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []WebhookAttempt
+	err := s.store.View(func(tx Tx) error {
+		aBucket, err := getChannelSubBucket(tx, channel, webhookAttemptsBucket, false)
+		if err != nil || aBucket == nil {
+			return err
+		}
+
+		return aBucket.ForEach(func(id, raw []byte) error {
+			var a WebhookAttempt
+			if err := json.Unmarshal(raw, &a); err != nil {
+				return err
+			}
+			if q.WebhookID == 0 || q.WebhookID == a.WebhookID {
+				list = append(list, a)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return []WebhookAttempt{}, err
+	}
+
+	// Newest first
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+	}
+	return list, nil
+}
@@ -0,0 +1,411 @@
+package claudine_bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+var (
+	webhooksBucket    = []byte("webhooks")
+	deadLettersBucket = []byte("webhook_dead_letters")
+)
+
+// Events webhooks can be sent for.
+const (
+	EventStreamOnline    = "stream_online"
+	EventStreamOffline   = "stream_offline"
+	EventCommandAdded    = "command_added"
+	EventCommandUpdated  = "command_updated"
+	EventCommandDeleted  = "command_deleted"
+	EventCommandExecuted = "command_executed"
+)
+
+// Webhook payload formats.
+const (
+	WebhookFormatJSON    = "json"
+	WebhookFormatDiscord = "discord"
+)
+
+// discordTemplate posts the notification as a Discord message.
+const discordTemplate = `{"content": {{json .Message}}}`
+
+var (
+	ErrInvalidPayload = errors.New("webhook template did not produce JSON")
+	ErrWebhookAddress = errors.New("webhook address is not public")
+)
+
+// AllowPrivateWebhooks lets webhooks be added for and sent to loopback, private
+// and link-local addresses, to try them against a local server. Only turn it on
+// where nobody else can add webhooks.
+var AllowPrivateWebhooks = false
+
+// privateNetworks are the loopback, private and link-local networks webhooks
+// can't be sent to, so they can't reach services next to the bot.
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// publicIP reports whether webhooks can be sent to ip.
+func publicIP(ip net.IP) bool {
+	if ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialer only connects to public addresses. It checks the address that
+// is actually dialled, after DNS and on every redirect, so neither can be used
+// to get around it.
+var webhookDialer = &net.Dialer{
+	Timeout: 10 * time.Second,
+	Control: func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || (!publicIP(ip) && !AllowPrivateWebhooks) {
+			return ErrWebhookAddress
+		}
+		return nil
+	},
+}
+
+// Webhook is a URL notified when events happen in a channel.
+type Webhook struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	// Events to send, all of them when empty.
+	Events []string `json:"events"`
+	// Format is a payload preset, used when there is no Template.
+	Format string `json:"format"`
+	// Template renders the JSON payload from the WebhookVariables.
+	Template string `json:"template,omitempty"`
+	// Secret signs each payload. One is made when the webhook is added, and it
+	// is only shown then.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookVariables describe an event to a webhook. They are the payload of the
+// json format and the variables of payload templates.
+type WebhookVariables struct {
+	Event     string    `json:"event"`
+	Channel   string    `json:"channel"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	Game      string    `json:"game,omitempty"`
+	Viewers   int       `json:"viewers,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	// Command that was changed or run, and the user who ran it.
+	Command *Command `json:"command,omitempty"`
+	User    string   `json:"user,omitempty"`
+	// Message sums up the event for chat apps.
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// WebhookDeadLetter is a payload that couldn't be delivered.
+type WebhookDeadLetter struct {
+	ID        int             `json:"id"`
+	WebhookID int             `json:"webhook_id"`
+	URL       string          `json:"url"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+}
+
+func validWebhookEvent(event string) bool {
+	switch event {
+	case EventStreamOnline, EventStreamOffline, EventCommandAdded, EventCommandUpdated, EventCommandDeleted, EventCommandExecuted:
+		return true
+	}
+	return false
+}
+
+// Wants reports whether the webhook is sent for the event.
+func (w Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Webhook) template() (*template.Template, error) {
+	text := w.Template
+	if text == "" && w.Format == WebhookFormatDiscord {
+		text = discordTemplate
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("Webhook").Funcs(webhookFuncs).Parse(text)
+}
+
+// Payload renders the body sent for an event.
+func (w Webhook) Payload(vars WebhookVariables) ([]byte, error) {
+	t, err := w.template()
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return json.Marshal(vars)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, vars); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, ErrInvalidPayload
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the hex HMAC-SHA256 of the payload with the webhook's secret.
+func (w Webhook) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w Webhook) validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidArgument
+	}
+	// Names are checked when the webhook is sent, once they're resolved
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); !AllowPrivateWebhooks && ((ip != nil && !publicIP(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost")) {
+		return ErrInvalidArgument
+	}
+	if w.Format != WebhookFormatJSON && w.Format != WebhookFormatDiscord {
+		return ErrInvalidArgument
+	}
+	for _, event := range w.Events {
+		if !validWebhookEvent(event) {
+			return ErrInvalidArgument
+		}
+	}
+	if _, err := w.template(); err != nil {
+		return ErrInvalidArgument
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func (s *claudineService) AddWebhook(ctx context.Context, channel string, w Webhook) (Webhook, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if w.Format == "" {
+		w.Format = WebhookFormatJSON
+	}
+	if err := w.validate(); err != nil {
+		return Webhook{}, err
+	}
+	if w.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return Webhook{}, err
+		}
+		w.Secret = secret
+	}
+	w.CreatedAt = time.Now().UTC()
+
+	err := s.store.Update(func(tx Tx) error {
+		wBucket, err := getChannelSubBucket(tx, channel, webhooksBucket, true)
+		if err != nil {
+			return err
+		}
+
+		id, err := wBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		w.ID = int(id)
+
+		return putJSON(wBucket, itob(w.ID), w)
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return w, nil
+}
+
+func (s *claudineService) GetWebhook(ctx context.Context, channel string, id int) (Webhook, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var w Webhook
+	err := s.store.View(func(tx Tx) error {
+		wBucket, err := getChannelSubBucket(tx, channel, webhooksBucket, false)
+		if err != nil {
+			return err
+		}
+		if wBucket == nil {
+			return ErrNotFound
+		}
+
+		return getJSON(wBucket, itob(id), &w)
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return w, nil
+}
+
+func (s *claudineService) ListWebhook(ctx context.Context, channel string) ([]Webhook, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []Webhook
+	err := s.store.View(func(tx Tx) error {
+		wBucket, err := getChannelSubBucket(tx, channel, webhooksBucket, false)
+		if err != nil || wBucket == nil {
+			return err
+		}
+
+		return wBucket.ForEach(func(id, raw []byte) error {
+			var w Webhook
+			if err := json.Unmarshal(raw, &w); err != nil {
+				return err
+			}
+			list = append(list, w)
+			return nil
+		})
+	})
+	if err != nil {
+		return []Webhook{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) DeleteWebhook(ctx context.Context, channel string, id int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		wBucket, err := getChannelSubBucket(tx, channel, webhooksBucket, false)
+		if err != nil {
+			return err
+		}
+		if wBucket == nil {
+			return ErrNotFound
+		}
+
+		if wBucket.Get(itob(id)) == nil {
+			return ErrNotFound
+		}
+		return wBucket.Delete(itob(id))
+	})
+}
+
+func (s *claudineService) ListWebhookDeadLetter(ctx context.Context, channel string) ([]WebhookDeadLetter, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var list []WebhookDeadLetter
+	err := s.store.View(func(tx Tx) error {
+		dBucket, err := getChannelSubBucket(tx, channel, deadLettersBucket, false)
+		if err != nil || dBucket == nil {
+			return err
+		}
+
+		return dBucket.ForEach(func(id, raw []byte) error {
+			var d WebhookDeadLetter
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return err
+			}
+			list = append(list, d)
+			return nil
+		})
+	})
+	if err != nil {
+		return []WebhookDeadLetter{}, err
+	}
+
+	return list, nil
+}
+
+func (s *claudineService) DeleteWebhookDeadLetter(ctx context.Context, channel string, id int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.store.Update(func(tx Tx) error {
+		dBucket, err := getChannelSubBucket(tx, channel, deadLettersBucket, false)
+		if err != nil {
+			return err
+		}
+		if dBucket == nil {
+			return ErrNotFound
+		}
+
+		if dBucket.Get(itob(id)) == nil {
+			return ErrNotFound
+		}
+		return dBucket.Delete(itob(id))
+	})
+}